@@ -0,0 +1,252 @@
+package gostats
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// AggregateMode selects what a BatchingSink sends for every gauge of a
+// batched window.
+type AggregateMode int
+
+const (
+	// AggregateLast sends the latest value of every gauge in the window.
+	// The collector then outputs cpu.NumGoroutineMax as the largest
+	// goroutine count over the window and adds cpu.NumGoroutineMin, the
+	// smallest, capturing the transient spikes and dips the latest value
+	// misses.
+	AggregateLast AggregateMode = iota
+
+	// AggregateMinMaxAvg sends the smallest, largest and average value of
+	// every gauge in the window, under the key suffixed with .min, .max and
+	// .avg.
+	AggregateMinMaxAvg
+)
+
+// BatchingSink decouples the collection interval from the send one, passing
+// the metrics on to the sink it wraps only once every few collection passes.
+// The collector can then sample frequently for accuracy while sending
+// rarely to save bandwidth. Over a window:
+//
+//   - gauges are aggregated as chosen by the AggregateMode,
+//   - counters, being increments, are summed,
+//   - timestamps are those of the latest pass.
+//
+// Metrics still batched when the sink is closed are sent before closing the
+// wrapped one.
+type BatchingSink struct {
+	next   Sink
+	every  int
+	mode   AggregateMode
+	passes int
+
+	// Aggregates of the current window, in the order first seen. Entries
+	// are kept across windows so steady keys don't allocate.
+	gauges    map[string]*aggregate
+	gaugeKeys []string
+	counts    map[string]*aggregate
+	countKeys []string
+	ts        time.Time
+}
+
+// aggregate is the window of a single metric, counters using only n and
+// sum.
+type aggregate struct {
+	n, sum, last uint64
+	min, max     uint64
+	timestamped  bool
+
+	minKey, maxKey, avgKey string
+}
+
+// windowSink is a Sink aggregating several passes into a window, over which
+// the collector tracks the goroutine counts.
+type windowSink interface {
+	// goroutineWindow reports whether the sink sends the goroutine counts
+	// over its window, and whether the coming pass starts a new window.
+	goroutineWindow() (tracked bool, start bool)
+}
+
+// Batch returns a sink passing the metrics on to next once every given
+// number of collection passes, aggregated as mode selects, for use with
+// CollectTo.
+func Batch(every int, mode AggregateMode, next Sink) *BatchingSink {
+	if every < 1 {
+		every = 1
+	}
+	return &BatchingSink{
+		next:   next,
+		every:  every,
+		mode:   mode,
+		gauges: make(map[string]*aggregate),
+		counts: make(map[string]*aggregate),
+	}
+}
+
+func (s *BatchingSink) Gauge(key string, value uint64) error {
+	s.add(key, value)
+	return nil
+}
+
+func (s *BatchingSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	s.add(key, value).timestamped = true
+	s.ts = ts
+	return nil
+}
+
+func (s *BatchingSink) add(key string, value uint64) *aggregate {
+	a, ok := s.gauges[key]
+	if !ok {
+		a = &aggregate{}
+		if s.mode == AggregateMinMaxAvg {
+			a.minKey, a.maxKey, a.avgKey = key+".min", key+".max", key+".avg"
+		}
+		s.gauges[key] = a
+		s.gaugeKeys = append(s.gaugeKeys, key)
+	}
+	if a.n == 0 || value < a.min {
+		a.min = value
+	}
+	if a.n == 0 || value > a.max {
+		a.max = value
+	}
+	a.n++
+	a.sum += value
+	a.last = value
+	return a
+}
+
+func (s *BatchingSink) Count(key string, delta uint64) error {
+	a, ok := s.counts[key]
+	if !ok {
+		a = &aggregate{}
+		s.counts[key] = a
+		s.countKeys = append(s.countKeys, key)
+	}
+	a.n++
+	a.sum += delta
+	return nil
+}
+
+// Flush ends a collection pass, sending the window once it is complete.
+func (s *BatchingSink) Flush() error {
+	s.passes++
+	if s.passes < s.every {
+		return nil
+	}
+	return s.send()
+}
+
+// send passes the window on to the wrapped sink and starts a new one.
+func (s *BatchingSink) send() error {
+	s.passes = 0
+
+	var err error
+	keep := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	for _, key := range s.gaugeKeys {
+		a := s.gauges[key]
+		if a.n == 0 {
+			continue
+		}
+		if s.mode == AggregateMinMaxAvg {
+			keep(s.gauge(a.minKey, a.min, a.timestamped))
+			keep(s.gauge(a.maxKey, a.max, a.timestamped))
+			keep(s.gauge(a.avgKey, a.sum/a.n, a.timestamped))
+		} else {
+			keep(s.gauge(key, a.last, a.timestamped))
+		}
+		a.n, a.sum, a.timestamped = 0, 0, false
+	}
+	for _, key := range s.countKeys {
+		a := s.counts[key]
+		if a.n == 0 {
+			continue
+		}
+		if next, ok := s.next.(CounterSink); ok {
+			keep(next.Count(key, a.sum))
+		} else {
+			keep(s.next.Gauge(key, a.sum))
+		}
+		a.n, a.sum = 0, 0
+	}
+	keep(s.next.Flush())
+	return err
+}
+
+func (s *BatchingSink) gauge(key string, value uint64, timestamped bool) error {
+	if next, ok := s.next.(TimestampedSink); ok && timestamped {
+		return next.GaugeAt(key, value, s.ts)
+	}
+	return s.next.Gauge(key, value)
+}
+
+func (s *BatchingSink) CollectDuration(d time.Duration) {
+	if next, ok := s.next.(durationSink); ok {
+		next.CollectDuration(d)
+	}
+}
+
+func (s *BatchingSink) SetWriteDeadline(t time.Time) error {
+	if next, ok := s.next.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		return next.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// Drain sends the metrics batched so far without waiting for the window to
+// complete, then drains the wrapped sink if it buffers too. The metrics of
+// the window count as flushed, those of the wrapped sink are added.
+func (s *BatchingSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	flushed = s.pending()
+	if err := s.send(); err != nil {
+		return 0, flushed, err
+	}
+	if next, ok := s.next.(Drainer); ok {
+		f, d, err := next.Drain(ctx)
+		return flushed + f, d, err
+	}
+	return flushed, 0, nil
+}
+
+// pending returns the number of metrics the window would send.
+func (s *BatchingSink) pending() int {
+	n := 0
+	for _, a := range s.gauges {
+		switch {
+		case a.n == 0:
+		case s.mode == AggregateMinMaxAvg:
+			n += 3
+		default:
+			n++
+		}
+	}
+	for _, a := range s.counts {
+		if a.n > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *BatchingSink) goroutineWindow() (tracked bool, start bool) {
+	return s.mode == AggregateLast, s.passes == 0
+}
+
+// Close sends the metrics still batched and closes the wrapped sink.
+func (s *BatchingSink) Close() error {
+	err := s.send()
+	if next, ok := s.next.(io.Closer); ok {
+		if cerr := next.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
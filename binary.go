@@ -0,0 +1,145 @@
+package gostats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BinarySink writes every collection pass as a single length prefixed
+// binary frame, a fraction of the size of text statsd, for collecting very
+// frequently across large fleets. DecodeBinary reads it back. The wire
+// format is a sequence of frames, integers being varints as encoded by
+// encoding/binary:
+//
+//	frame  = uvarint(len(body)) body
+//	body   = varint(timestamp) uvarint(count) metric...
+//	metric = uvarint(len(key)) key uvarint(value)
+//
+// where timestamp is the time of the pass in nanoseconds since the Unix
+// epoch, count the number of metrics following, and key the UTF-8 bytes of
+// the full key. A frame is written on every Flush, none for an empty pass.
+type BinarySink struct {
+	w     io.Writer
+	ts    time.Time
+	count uint64
+	body  []byte
+	frame []byte
+}
+
+// maxBinaryFrame bounds the frames DecodeBinary accepts, so a corrupt length
+// can't make it allocate without limit.
+const maxBinaryFrame = 16 << 20
+
+// NewBinarySink returns a sink writing binary frames to w, for use with
+// CollectTo.
+func NewBinarySink(w io.Writer) *BinarySink {
+	return &BinarySink{w: w}
+}
+
+func (s *BinarySink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *BinarySink) GaugeAt(key string, value uint64, ts time.Time) error {
+	if s.count == 0 {
+		s.ts = ts
+	}
+	s.count++
+	s.body = binary.AppendUvarint(s.body, uint64(len(key)))
+	s.body = append(s.body, key...)
+	s.body = binary.AppendUvarint(s.body, value)
+	return nil
+}
+
+func (s *BinarySink) Flush() error {
+	if s.count == 0 {
+		return nil
+	}
+	defer func() {
+		s.body = s.body[:0]
+		s.count = 0
+	}()
+
+	var head [2 * binary.MaxVarintLen64]byte
+	h := binary.AppendVarint(head[:0], s.ts.UnixNano())
+	h = binary.AppendUvarint(h, s.count)
+
+	frame := binary.AppendUvarint(s.frame[:0], uint64(len(h)+len(s.body)))
+	frame = append(frame, h...)
+	frame = append(frame, s.body...)
+	s.frame = frame
+	_, err := s.w.Write(frame)
+	return err
+}
+
+// errCorruptFrame is returned by BinaryDecoder.Next for a frame that doesn't
+// parse.
+var errCorruptFrame = errors.New("corrupt binary frame")
+
+// BinaryDecoder reads the frames written by BinarySink.
+type BinaryDecoder struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// DecodeBinary returns a decoder of the frames read from r.
+func DecodeBinary(r io.Reader) *BinaryDecoder {
+	return &BinaryDecoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the pass of the next frame, or io.EOF once r ends between
+// frames.
+func (d *BinaryDecoder) Next() (TimestampedSnapshot, error) {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return TimestampedSnapshot{}, err
+	}
+	if size > maxBinaryFrame {
+		return TimestampedSnapshot{}, fmt.Errorf("binary frame of %d bytes too large", size)
+	}
+	if uint64(cap(d.buf)) < size {
+		d.buf = make([]byte, size)
+	}
+	body := d.buf[:size]
+	if _, err := io.ReadFull(d.r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return TimestampedSnapshot{}, err
+	}
+
+	ts, n := binary.Varint(body)
+	if n <= 0 {
+		return TimestampedSnapshot{}, errCorruptFrame
+	}
+	body = body[n:]
+	count, n := binary.Uvarint(body)
+	if n <= 0 || count > uint64(len(body)) {
+		return TimestampedSnapshot{}, errCorruptFrame
+	}
+	body = body[n:]
+
+	pass := TimestampedSnapshot{Time: time.Unix(0, ts), Values: make(Snapshot, count)}
+	for i := uint64(0); i < count; i++ {
+		keyLen, n := binary.Uvarint(body)
+		if n <= 0 || keyLen > uint64(len(body)-n) {
+			return TimestampedSnapshot{}, errCorruptFrame
+		}
+		key := string(body[n : n+int(keyLen)])
+		body = body[n+int(keyLen):]
+		value, n := binary.Uvarint(body)
+		if n <= 0 {
+			return TimestampedSnapshot{}, errCorruptFrame
+		}
+		body = body[n:]
+		pass.Values[key] = value
+	}
+	if len(body) != 0 {
+		return TimestampedSnapshot{}, errCorruptFrame
+	}
+	return pass, nil
+}
@@ -0,0 +1,70 @@
+package gostats
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// BySize makes the collector output the live objects of every allocation
+// size class, the objects allocated less those freed, as
+// mem.bysize.<size>.Live with the memory statistics. It shows which object
+// sizes dominate the live heap. There are some 60 size classes, so
+// BySizeTopN is worth setting with it.
+var BySize = false
+
+// BySizeTopN, when positive, limits BySize to the size classes holding the
+// most live objects in the pass.
+var BySizeTopN = 0
+
+// bySizeClasses is the number of size classes in runtime.MemStats.
+const bySizeClasses = len(runtime.MemStats{}.BySize)
+
+// bySizeStats holds the keys of the size classes, built on first use, and
+// the order they are output in.
+type bySizeStats struct {
+	keys  [bySizeClasses]string
+	live  [bySizeClasses]uint64
+	order [bySizeClasses]int
+}
+
+func (c *collector) outputBySize(m *runtime.MemStats) {
+	if c.bySizeStats == nil {
+		c.bySizeStats = &bySizeStats{}
+		for i, class := range m.BySize {
+			c.bySizeStats.keys[i] = "mem.bysize." + strconv.FormatUint(uint64(class.Size), 10) + ".Live"
+		}
+	}
+	bs := c.bySizeStats
+
+	// The first class is of size zero and never used.
+	n := 0
+	for i, class := range m.BySize {
+		if class.Size == 0 {
+			continue
+		}
+		// Frees and Mallocs are read at slightly different times, so
+		// guard against the former overtaking the latter.
+		bs.live[i] = sub(class.Mallocs, class.Frees)
+		bs.order[n] = i
+		n++
+	}
+
+	if c.bySizeTopN > 0 && c.bySizeTopN < n {
+		// A partial selection sort, the classes are few and this keeps the
+		// pass free of allocations.
+		for i := 0; i < c.bySizeTopN; i++ {
+			most := i
+			for j := i + 1; j < n; j++ {
+				if bs.live[bs.order[j]] > bs.live[bs.order[most]] {
+					most = j
+				}
+			}
+			bs.order[i], bs.order[most] = bs.order[most], bs.order[i]
+		}
+		n = c.bySizeTopN
+	}
+
+	for _, i := range bs.order[:n] {
+		c.send(bs.keys[i], bs.live[i])
+	}
+}
@@ -0,0 +1,99 @@
+package gostats
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Capture is a local statsd endpoint that records every gauge it receives,
+// meant for verifying the emitted metrics in tests:
+//
+//	cp, _ := gostats.NewCapture()
+//	defer cp.Close()
+//	gostats.Collect(cp.Endpoint(), "test", 1, true, true, true)
+type Capture struct {
+	conn net.PacketConn
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// NewCapture starts a capturing statsd endpoint on a random local port.
+func NewCapture() (*Capture, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Capture{
+		conn:   conn,
+		values: make(map[string]uint64),
+	}
+	go cp.serve()
+	return cp, nil
+}
+
+// Endpoint returns the host:port pair to pass to Collect.
+func (cp *Capture) Endpoint() string {
+	return cp.conn.LocalAddr().String()
+}
+
+// Values returns a copy of the last value received for every key.
+func (cp *Capture) Values() map[string]uint64 {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	values := make(map[string]uint64, len(cp.values))
+	for k, v := range cp.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Value returns the last value received for key.
+func (cp *Capture) Value(key string) (uint64, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	v, ok := cp.values[key]
+	return v, ok
+}
+
+// Close stops the endpoint, values received so far remain available.
+func (cp *Capture) Close() error {
+	return cp.conn.Close()
+}
+
+func (cp *Capture) serve() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := cp.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			cp.record(line)
+		}
+	}
+}
+
+// record parses a "key:value|type" statsd line.
+func (cp *Capture) record(line string) {
+	if i := strings.IndexByte(line, '|'); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.LastIndexByte(line, ':')
+	if i <= 0 {
+		return
+	}
+	value, err := strconv.ParseUint(line[i+1:], 10, 64)
+	if err != nil {
+		return
+	}
+
+	cp.mu.Lock()
+	cp.values[line[:i]] = value
+	cp.mu.Unlock()
+}
@@ -0,0 +1,9 @@
+package gostats
+
+func (c *collector) outputCGroupQuota() {
+	milli, ok := c.cgroupCPU.read(c)
+	if !ok {
+		return
+	}
+	c.send("cpu.CGroupQuotaMilli", milli)
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package gostats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cgroupCPUReader reads the CPU quota of the cgroup of the process, from
+// cpu.max under cgroup v2 or cpu.cfs_quota_us and cpu.cfs_period_us under
+// v1, keeping the files open between passes.
+type cgroupCPUReader struct {
+	// cpu.max, or the v1 quota and period.
+	max    *os.File
+	quota  *os.File
+	period *os.File
+
+	failed bool
+	buf    [64]byte
+}
+
+// read returns the quota in thousandths of a CPU, zero if unlimited.
+func (r *cgroupCPUReader) read(c *collector) (milli uint64, ok bool) {
+	if r.failed {
+		return 0, false
+	}
+	if r.max == nil && r.quota == nil && !r.open() {
+		c.logger.Warn("no cgroup cpu controller found, cgroup CPU quota disabled")
+		r.failed = true
+		return 0, false
+	}
+
+	var quota, period uint64
+	if r.max != nil {
+		// "max 100000" when unlimited, "200000 100000" for two CPUs.
+		b, err := r.readFile(r.max)
+		if err != nil {
+			c.logger.Warn("error reading cgroup cpu.max", "error", err)
+			return 0, false
+		}
+		if bytes.HasPrefix(b, []byte("max")) {
+			return 0, true
+		}
+		var rest []byte
+		if quota, rest, ok = parseField(b); !ok {
+			return 0, false
+		}
+		if period, _, ok = parseField(rest); !ok {
+			return 0, false
+		}
+	} else {
+		// A quota of -1 when unlimited.
+		b, err := r.readFile(r.quota)
+		if err != nil {
+			c.logger.Warn("error reading cgroup cpu.cfs_quota_us", "error", err)
+			return 0, false
+		}
+		if bytes.HasPrefix(b, []byte("-")) {
+			return 0, true
+		}
+		if quota, _, ok = parseField(b); !ok {
+			return 0, false
+		}
+		if b, err = r.readFile(r.period); err != nil {
+			c.logger.Warn("error reading cgroup cpu.cfs_period_us", "error", err)
+			return 0, false
+		}
+		if period, _, ok = parseField(b); !ok {
+			return 0, false
+		}
+	}
+	if period == 0 {
+		return 0, false
+	}
+	return quota * 1000 / period, true
+}
+
+// open opens the quota files of the cgroup of the process, as listed in
+// /proc/self/cgroup, under cgroup v2 or failing that v1. The nearest
+// ancestor with the files is used if the cgroup itself has none, as when
+// the controller isn't enabled for it.
+func (r *cgroupCPUReader) open() bool {
+	data, _ := os.ReadFile("/proc/self/cgroup")
+	v2, v1 := cgroupPaths(data)
+
+	for _, dir := range cgroupDirs("/sys/fs/cgroup", v2) {
+		if f, err := os.Open(dir + "/cpu.max"); err == nil {
+			r.max = f
+			return true
+		}
+	}
+	for _, mount := range []string{"/sys/fs/cgroup/cpu", "/sys/fs/cgroup/cpu,cpuacct"} {
+		for _, dir := range cgroupDirs(mount, v1) {
+			quota, err := os.Open(dir + "/cpu.cfs_quota_us")
+			if err != nil {
+				continue
+			}
+			period, err := os.Open(dir + "/cpu.cfs_period_us")
+			if err != nil {
+				quota.Close()
+				continue
+			}
+			r.quota, r.period = quota, period
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupPaths returns the cgroup v2 path and the v1 path of the cpu
+// controller from the content of /proc/self/cgroup, "/" for those not
+// listed.
+func cgroupPaths(data []byte) (v2 string, v1 string) {
+	v2, v1 = "/", "/"
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2 = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpu" {
+				v1 = fields[2]
+			}
+		}
+	}
+	return v2, v1
+}
+
+// cgroupDirs returns the directory of the cgroup at path under mount,
+// followed by those of its ancestors up to mount itself.
+func cgroupDirs(mount string, path string) []string {
+	dirs := []string{}
+	for {
+		dirs = append(dirs, filepath.Join(mount, path))
+		if path == "/" || path == "." || path == "" {
+			return dirs
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+func (r *cgroupCPUReader) readFile(f *os.File) ([]byte, error) {
+	n, err := f.ReadAt(r.buf[:], 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return r.buf[:n], nil
+}
+
+func (r *cgroupCPUReader) close() {
+	for _, f := range []*os.File{r.max, r.quota, r.period} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
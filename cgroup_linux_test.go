@@ -0,0 +1,36 @@
+//go:build linux
+
+package gostats
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCgroupPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		v2, v1 string
+	}{
+		{"v2", "0::/system.slice/app.service\n", "/system.slice/app.service", "/"},
+		{"v1", "12:memory:/user.slice\n4:cpu,cpuacct:/system.slice/app.service\n1:name=systemd:/system.slice/app.service\n", "/", "/system.slice/app.service"},
+		{"hybrid", "4:cpu,cpuacct:/a\n0::/b\n", "/b", "/a"},
+		{"namespaced", "0::/\n", "/", "/"},
+		{"missing", "", "/", "/"},
+	}
+	for _, tt := range tests {
+		v2, v1 := cgroupPaths([]byte(tt.data))
+		if v2 != tt.v2 || v1 != tt.v1 {
+			t.Errorf("%s: cgroupPaths() = %q, %q, want %q, %q", tt.name, v2, v1, tt.v2, tt.v1)
+		}
+	}
+}
+
+func TestCgroupDirs(t *testing.T) {
+	got := cgroupDirs("/sys/fs/cgroup", "/system.slice/app.service")
+	want := []string{"/sys/fs/cgroup/system.slice/app.service", "/sys/fs/cgroup/system.slice", "/sys/fs/cgroup"}
+	if !slices.Equal(got, want) {
+		t.Errorf("cgroupDirs() = %q, want %q", got, want)
+	}
+}
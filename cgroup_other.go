@@ -0,0 +1,12 @@
+//go:build !linux
+
+package gostats
+
+// cgroupCPUReader reads nothing, cgroups being Linux only.
+type cgroupCPUReader struct{}
+
+func (r *cgroupCPUReader) read(c *collector) (milli uint64, ok bool) {
+	return 0, false
+}
+
+func (r *cgroupCPUReader) close() {}
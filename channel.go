@@ -0,0 +1,57 @@
+package gostats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metric is a single value sent to a ChannelSink.
+type Metric struct {
+	Key   string
+	Value uint64
+	Time  time.Time
+}
+
+// ChannelSink sends every metric to a channel, leaving batching, aggregation
+// and routing to the goroutine receiving from it. Sends never block the
+// collector: a metric is dropped when the channel is full, and the number of
+// dropped metrics is reported by Dropped and output as cpu.SinkDropped.
+type ChannelSink struct {
+	ch      chan<- Metric
+	dropped atomic.Uint64
+}
+
+// NewChannelSink returns a sink sending to ch, for use with CollectTo. The
+// channel should be buffered to hold at least one collection pass.
+func NewChannelSink(ch chan<- Metric) *ChannelSink {
+	return &ChannelSink{ch: ch}
+}
+
+// NewChannel returns a channel buffered to hold size metrics along with a
+// sink sending to it.
+func NewChannel(size int) (<-chan Metric, *ChannelSink) {
+	ch := make(chan Metric, size)
+	return ch, NewChannelSink(ch)
+}
+
+func (s *ChannelSink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *ChannelSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	select {
+	case s.ch <- Metric{Key: key, Value: value, Time: ts}:
+	default:
+		s.dropped.Add(1)
+	}
+	return nil
+}
+
+func (s *ChannelSink) Flush() error {
+	return nil
+}
+
+// Dropped returns the number of metrics dropped because the channel was full.
+func (s *ChannelSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,153 @@
+package gostats
+
+import "strings"
+
+// CompactKeys sends metrics under the short names listed below, keeping their
+// section but abbreviating the rest, for example mem.heap.ta for
+// mem.heap.TotalAlloc. Delta keys end in .d instead of .delta. This cuts the
+// packet size and index footprint of frequent collection; metrics without a
+// short name, such as the runtime/metrics ones, keep their verbose name.
+var CompactKeys = false
+
+// compactNames maps the verbose buckets to their short names.
+var compactNames = map[string]string{
+	"cpu.NumGoroutine":          "cpu.ng",
+	"cpu.NumGoroutineMax":       "cpu.ngm",
+	"cpu.NumGoroutineMin":       "cpu.ngn",
+	"cpu.NumCgoCall":            "cpu.cgo",
+	"cpu.GoroutinesCreated":     "cpu.grc",
+	"cpu.BlockEvents":           "cpu.be",
+	"cpu.BlockCyclesTotal":      "cpu.bc",
+	"cpu.MutexContentionEvents": "cpu.me",
+	"cpu.MutexContentionCycles": "cpu.mc",
+	"cpu.CollectIntervalMs":     "cpu.ivl",
+	"cpu.GOMAXPROCS":            "cpu.mp",
+	"cpu.NumCPU":                "cpu.nc",
+	"cpu.ProcsCPURatioPPM":      "cpu.mpr",
+	"cpu.CGroupQuotaMilli":      "cpu.cq",
+	"cpu.MemStatsHealthy":       "cpu.msh",
+	"cpu.MetricsAvailable":      "cpu.ma",
+	"cpu.WallClockUnixMs":       "cpu.wc",
+	"cpu.CollectSeq":            "cpu.seq",
+	"cpu.ClockDriftMs":          "cpu.drift",
+	"cpu.ClockAhead":            "cpu.ahead",
+	"cpu.SinkDropped":           "cpu.drop",
+	"cpu.SinkQueued":            "cpu.sq",
+	"cpu.CollectorAllocBytes":   "cpu.cab",
+	"cpu.CollectDurationNs":     "cpu.cd",
+	"cpu.SeriesBudgetExceeded":  "cpu.sbe",
+	"cpu.BreakerTrips":          "cpu.bt",
+	"cpu.CollectorRestarts":     "cpu.cr",
+	"cpu.SchedLatencyP50":       "cpu.sl50",
+	"cpu.SchedLatencyP99":       "cpu.sl99",
+	"cpu.SchedLatency":          "cpu.sl",
+	"cpu.GCCPUFraction":         "cpu.gcf",
+
+	"mem.sys.Sys":         "mem.sys.sys",
+	"mem.sys.Lookups":     "mem.sys.lk",
+	"mem.sys.OtherSys":    "mem.sys.os",
+	"mem.sys.BuckHashSys": "mem.sys.bh",
+
+	"mem.com.Total_VM_Bytes_Reserved":         "mem.com.vm",
+	"mem.com.Live_Heap_Bytes_Allocated":       "mem.com.lh",
+	"mem.com.Cumulative_Heap_Bytes_Allocated": "mem.com.ch",
+	"mem.com.Total_Stack_Allocation":          "mem.com.st",
+	"mem.com.Other_Bytes_Allocation":          "mem.com.ot",
+	"mem.com.TotalRuntimeBytes":               "mem.com.rt",
+	"mem.com.EstimatedRSSBytes":               "mem.com.rss",
+	"mem.com.AllocRate":                       "mem.com.ar",
+
+	"mem.heap.Alloc":                  "mem.heap.a",
+	"mem.heap.TotalAlloc":             "mem.heap.ta",
+	"mem.heap.Mallocs":                "mem.heap.m",
+	"mem.heap.Frees":                  "mem.heap.f",
+	"mem.heap.HeapAlloc":              "mem.heap.ha",
+	"mem.heap.HeapSys":                "mem.heap.hs",
+	"mem.heap.HeapSysDelta":           "mem.heap.hsd",
+	"mem.heap.HeapIdle":               "mem.heap.hi",
+	"mem.heap.HeapInuse":              "mem.heap.hu",
+	"mem.heap.HeapReleased":           "mem.heap.hr",
+	"mem.heap.HeapObjects":            "mem.heap.ho",
+	"mem.heap.HeapObjectsDelta":       "mem.heap.hod",
+	"mem.heap.MallocRate":             "mem.heap.mr",
+	"mem.heap.FreeRate":               "mem.heap.fr",
+	"mem.heap.MallocsPerInterval":     "mem.heap.mpi",
+	"mem.heap.FreesPerInterval":       "mem.heap.fpi",
+	"mem.heap.UtilizationPPM":         "mem.heap.up",
+	"mem.heap.TurnoverRatioPPM":       "mem.heap.tr",
+	"mem.heap.AvgObjectSizeBytes":     "mem.heap.aos",
+	"mem.heap.RetainedIdle":           "mem.heap.ri",
+	"mem.heap.ReleaseEfficiencyPPM":   "mem.heap.rep",
+	"mem.heap.ForcedReleaseBytes":     "mem.heap.frb",
+	"mem.heap.BackgroundReleaseBytes": "mem.heap.brb",
+
+	"mem.os.RSSBytes":   "mem.os.rss",
+	"mem.os.VSizeBytes": "mem.os.vsz",
+
+	"mem.stack.StackSys":         "mem.stack.ss",
+	"mem.stack.StackInuse":       "mem.stack.su",
+	"mem.stack.MSpanInuse":       "mem.stack.mu",
+	"mem.stack.MSpanSys":         "mem.stack.ms",
+	"mem.stack.MSpanSlack":       "mem.stack.msl",
+	"mem.stack.MCacheInuse":      "mem.stack.cu",
+	"mem.stack.MCacheSys":        "mem.stack.cs",
+	"mem.stack.MCacheSlack":      "mem.stack.csl",
+	"mem.stack.MSpanInuseDelta":  "mem.stack.mud",
+	"mem.stack.MCacheInuseDelta": "mem.stack.cud",
+
+	"mem.gc.GCSys":                      "mem.gc.sys",
+	"mem.gc.NextGC":                     "mem.gc.next",
+	"mem.gc.LastGC":                     "mem.gc.last",
+	"mem.gc.PauseTotalNs":               "mem.gc.ptn",
+	"mem.gc.Pause":                      "mem.gc.p",
+	"mem.gc.Pause.p50":                  "mem.gc.p.50",
+	"mem.gc.Pause.p95":                  "mem.gc.p.95",
+	"mem.gc.Pause.p99":                  "mem.gc.p.99",
+	"mem.gc.Pause.max":                  "mem.gc.p.max",
+	"mem.gc.NumGC":                      "mem.gc.n",
+	"mem.gc.NumGCPerInterval":           "mem.gc.npi",
+	"mem.gc.PauseCount":                 "mem.gc.pc",
+	"mem.gc.PauseSumNs":                 "mem.gc.ps",
+	"mem.gc.PauseIntervalTotalNs":       "mem.gc.pit",
+	"mem.gc.NextGCRatioPPM":             "mem.gc.nr",
+	"mem.gc.NextGCTrend":                "mem.gc.nt",
+	"mem.gc.CycleProgressPPM":           "mem.gc.cp",
+	"mem.gc.HeapGrowthSinceGCBytes":     "mem.gc.hgr",
+	"mem.gc.AllocPerCycleBytes":         "mem.gc.apc",
+	"mem.gc.LastPauseVsAvgPPM":          "mem.gc.lpa",
+	"mem.gc.Disabled":                   "mem.gc.off",
+	"mem.gc.Goal":                       "mem.gc.hg",
+	"mem.gc.Live":                       "mem.gc.lv",
+	"mem.gc.GoalVsLimitPPM":             "mem.gc.gl",
+	"mem.gc.Pressure":                   "mem.gc.pr",
+	"mem.gc.Pressure.Frequency":         "mem.gc.pr.f",
+	"mem.gc.Pressure.Pause":             "mem.gc.pr.p",
+	"mem.gc.Pressure.Headroom":          "mem.gc.pr.h",
+	"mem.Pressure":                      "mem.pr",
+	"mem.gc.cpu.MarkAssistNs":           "mem.gc.cpu.ma",
+	"mem.gc.cpu.MarkDedicatedNs":        "mem.gc.cpu.md",
+	"mem.gc.cpu.MarkIdleNs":             "mem.gc.cpu.mi",
+	"mem.gc.cpu.PauseNs":                "mem.gc.cpu.p",
+	"mem.gc.cpu.TotalNs":                "mem.gc.cpu.t",
+	"mem.gc.cpu.AssistSharePPM":         "mem.gc.cpu.as",
+	"mem.gc.finalizer.Queued":           "mem.gc.fin.q",
+	"mem.gc.finalizer.Executed":         "mem.gc.fin.x",
+	"mem.gc.finalizer.Backlog":          "mem.gc.fin.b",
+	"mem.gc.finalizer.CleanupsQueued":   "mem.gc.fin.cq",
+	"mem.gc.finalizer.CleanupsExecuted": "mem.gc.fin.cx",
+	"mem.gc.finalizer.CleanupsBacklog":  "mem.gc.fin.cb",
+}
+
+// compactName returns the short name of bucket, or bucket itself if it has
+// none.
+func compactName(bucket string) string {
+	if name, ok := compactNames[bucket]; ok {
+		return name
+	}
+	if base, found := strings.CutSuffix(bucket, ".delta"); found {
+		if name, ok := compactNames[base]; ok {
+			return name + ".d"
+		}
+	}
+	return bucket
+}
@@ -0,0 +1,119 @@
+package gostats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the configuration of a Collector, for running several of them
+// side by side with their own endpoint and prefix. The other options are
+// taken from the package variables when the Collector is created.
+type Config struct {
+	// Endpoint is the statsd endpoint to output to, unless Sink or Gauge
+	// is set.
+	Endpoint string
+
+	// Transport is the network Endpoint is dialed over, "udp" or "tcp",
+	// the package Transport if empty.
+	Transport string
+
+	// Sink is output to instead of statsd if set.
+	Sink Sink
+
+	// Gauge, if set and Sink isn't, is called with the full key and value
+	// of every metric instead of sending them to statsd.
+	Gauge GaugeFunc
+
+	// Prefix is the leading segment of every key, without any trailing
+	// dot. An empty prefix sends keys without one.
+	Prefix string
+
+	// Pause is the interval between two collection passes.
+	Pause time.Duration
+
+	// CPU, Mem and GC enable the CPU, memory and GC statistics.
+	CPU bool
+	Mem bool
+	GC  bool
+}
+
+// Collector collects the statistics selected by its Config, independently
+// of the package collector started by Collect and of any other Collector.
+type Collector struct {
+	col *collector
+
+	mu      sync.Mutex
+	started bool
+}
+
+// NewWithConfig validates cfg and the package options and returns a
+// Collector for it, connected to its endpoint but not collecting until
+// Start.
+func NewWithConfig(cfg Config) (*Collector, error) {
+	sink := cfg.Sink
+	if sink == nil && cfg.Gauge != nil {
+		sink = &funcSink{gauge: cfg.Gauge}
+	}
+	if sink == nil {
+		transport := cfg.Transport
+		var transportErr error
+		if transport == "" {
+			transport = Transport
+		} else {
+			transportErr = checkTransport("Config.Transport", transport)
+		}
+		if err := errors.Join(validateStart(cfg.Pause, append([]string{cfg.Endpoint}, Endpoints...)...), transportErr); err != nil {
+			return nil, err
+		}
+		s, err := dialStatsd(cfg.Endpoint, transport)
+		if err != nil {
+			return nil, err
+		}
+		sink = s
+	} else if err := validateStart(cfg.Pause); err != nil {
+		return nil, err
+	}
+	return &Collector{col: configure(sink, cfg)}, nil
+}
+
+// Start starts collecting in the background. Calls after the first, or
+// after Stop, do nothing.
+func (c *Collector) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	go c.col.run(context.Background())
+}
+
+// Stop ends the collection like the package Stop, returning once the final
+// output is out and the sink closed. A Collector never started only has its
+// sink closed. It is safe to call more than once.
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	started := c.started
+	c.started = true
+	c.mu.Unlock()
+	if !started {
+		c.col.closeSink()
+		return
+	}
+	c.col.stop()
+}
+
+// configure creates a collector for cfg, outputting to sink, with the
+// remaining options taken from the package ones.
+func configure(sink Sink, cfg Config) *collector {
+	col := newCollector(strings.TrimSuffix(cfg.Prefix, "."), sink, packageSettings())
+	col.pauseDur = cfg.Pause
+	if cfg.Mem {
+		col.floorMemInterval()
+	}
+	col.setEnabled(cfg.CPU, cfg.Mem, cfg.GC)
+	return col
+}
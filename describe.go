@@ -0,0 +1,235 @@
+package gostats
+
+import "strings"
+
+// MetricKind tells how a metric is sent.
+type MetricKind int
+
+const (
+	// KindGauge is a metric whose value is sent as is.
+	KindGauge MetricKind = iota
+
+	// KindCounter is a monotonically increasing metric, sent to sinks that
+	// support counters as such and following DeltaMode.
+	KindCounter
+
+	// KindTimer is the duration of an event in nanoseconds, sent as a timer
+	// to sinks that support timers.
+	KindTimer
+)
+
+func (k MetricKind) String() string {
+	switch k {
+	case KindCounter:
+		return "counter"
+	case KindTimer:
+		return "timer"
+	}
+	return "gauge"
+}
+
+// MetricDesc describes a built-in metric.
+type MetricDesc struct {
+	// Key is the bucket the metric is output under, before the prefix or
+	// template is applied.
+	Key  string
+	Help string
+	Unit string
+	Kind MetricKind
+}
+
+// Describe returns the description of every built-in metric, whether or not
+// enabled. Metrics passed through from runtime/metrics by
+// EnableAllRuntimeMetrics, HistogramBuckets, the size classes of BySize,
+// registered structs and sources aren't included.
+func Describe() []MetricDesc {
+	descs := make([]MetricDesc, len(metricDescs))
+	copy(descs, metricDescs)
+	return descs
+}
+
+// unitSink is a Sink told the unit of the built-in metrics, once per key
+// before it is first sent.
+type unitSink interface {
+	SetUnit(key string, unit string)
+}
+
+// metricUnits maps the built-in buckets to their unit.
+var metricUnits = func() map[string]string {
+	units := make(map[string]string, len(metricDescs))
+	for _, d := range metricDescs {
+		units[d.Key] = d.Unit
+	}
+	return units
+}()
+
+// kindSink is a Sink told the kind of the built-in metrics as sent, once per
+// key before it is first sent. The absolute value of a counter is sent as a
+// gauge, its delta as a counter.
+type kindSink interface {
+	SetKind(key string, kind MetricKind)
+
+	// Typed reports whether key is sent as something other than a gauge,
+	// left out of the final output at shutdown.
+	Typed(key string) bool
+}
+
+// metricKinds maps the built-in buckets to their kind.
+var metricKinds = func() map[string]MetricKind {
+	kinds := make(map[string]MetricKind, len(metricDescs))
+	for _, d := range metricDescs {
+		kinds[d.Key] = d.Kind
+	}
+	return kinds
+}()
+
+// sentKind returns the kind bucket is sent as, a counter for the delta of a
+// counter and a gauge for its absolute value.
+func sentKind(bucket string) MetricKind {
+	if base, found := strings.CutSuffix(bucket, ".delta"); found && metricKinds[base] == KindCounter {
+		return KindCounter
+	}
+	if kind := metricKinds[bucket]; kind == KindTimer {
+		return KindTimer
+	}
+	return KindGauge
+}
+
+// metricUnit returns the unit of bucket, empty if not a built-in metric.
+func metricUnit(bucket string) string {
+	if unit, ok := metricUnits[bucket]; ok {
+		return unit
+	}
+	if base, found := strings.CutSuffix(bucket, ".delta"); found {
+		return metricUnits[base]
+	}
+	return ""
+}
+
+var metricDescs = []MetricDesc{
+	{"cpu.NumGoroutine", "Goroutines currently existing", "goroutines", KindGauge},
+	{"cpu.NumGoroutineMax", "Most goroutines seen by the samples taken over the interval, or the window of a BatchingSink", "goroutines", KindGauge},
+	{"cpu.NumGoroutineMin", "Fewest goroutines over the window of a BatchingSink", "goroutines", KindGauge},
+	{"cpu.NumCgoCall", "Cgo calls made by the process", "calls", KindCounter},
+	{"cpu.GoroutinesCreated", "Goroutines created by the process, with EnableGoroutinesCreated on Go 1.26 and later", "goroutines", KindCounter},
+	{"cpu.BlockEvents", "Blocking events recorded by the block profile, with EnableBlockProfile", "events", KindCounter},
+	{"cpu.BlockCyclesTotal", "CPU cycles spent blocked as recorded by the block profile, with EnableBlockProfile", "cycles", KindCounter},
+	{"cpu.MutexContentionEvents", "Contended lock events recorded by the mutex profile, with EnableMutexProfile", "events", KindCounter},
+	{"cpu.MutexContentionCycles", "CPU cycles spent waiting on contended locks as recorded by the mutex profile, with EnableMutexProfile", "cycles", KindCounter},
+	{"cpu.CollectIntervalMs", "Interval between CPU collection passes, CPUInterval when set", "milliseconds", KindGauge},
+	{"cpu.CollectSeq", "Number of the collection pass counted from 1, with EmitSequence", "passes", KindGauge},
+	{"cpu.GOMAXPROCS", "Maximum number of CPUs executing Go code simultaneously, with SchedStats", "cpus", KindGauge},
+	{"cpu.NumCPU", "Logical CPUs usable by the process", "cpus", KindGauge},
+	{"cpu.ProcsCPURatioPPM", "GOMAXPROCS relative to NumCPU", "ppm", KindGauge},
+	{"cpu.CGroupQuotaMilli", "CPU quota of the cgroup of the process in thousandths of a CPU, zero if unlimited, on Linux", "millicpus", KindGauge},
+	{"cpu.MemStatsHealthy", "1 if ReadMemStats was found to reflect allocations before the first memory pass", "boolean", KindGauge},
+	{"cpu.MetricsAvailable", "Keys a pass outputs given the configuration, Go version and platform, counted on the first passes, zero until then", "keys", KindGauge},
+	{"cpu.WallClockUnixMs", "Wall clock of the collector, with EmitClock", "milliseconds", KindGauge},
+	{"cpu.ClockDriftMs", "Absolute drift of the wall clock from ClockReference", "milliseconds", KindGauge},
+	{"cpu.ClockAhead", "1 if the wall clock is ahead of ClockReference", "boolean", KindGauge},
+	{"cpu.CollectorAllocBytes", "Bytes allocated by every goroutine during the previous pass", "bytes", KindGauge},
+	{"cpu.CollectDurationNs", "Duration of the previous collection pass, with EmitCollectDuration", "nanoseconds", KindTimer},
+	{"cpu.SinkDropped", "Metrics dropped by the sink, for sinks that drop", "metrics", KindGauge},
+	{"cpu.SinkQueued", "Passes held back by the sink to be sent later, for sinks that queue", "passes", KindGauge},
+	{"cpu.BreakerTrips", "Times collection was paused by the circuit breaker, with BreakerFailures", "trips", KindGauge},
+	{"cpu.CollectorRestarts", "Times collection restarted after stopping on its own, with RestartBackoff", "restarts", KindCounter},
+	{"cpu.SeriesBudgetExceeded", "1 once new keys are dropped for exceeding MaxSeries", "boolean", KindGauge},
+	{"cpu.SchedLatencyP50", "Median time goroutines waited to be scheduled, with EnableSchedLatency", "nanoseconds", KindGauge},
+	{"cpu.SchedLatencyP99", "99th percentile time goroutines waited to be scheduled, with EnableSchedLatency", "nanoseconds", KindGauge},
+	{"cpu.SchedLatency", "99th percentile time goroutines waited to be scheduled, with SchedStats", "nanoseconds", KindGauge},
+	{"cpu.GCCPUFraction", "Share of the available CPU used by the GC since the program started, with SchedStats", "ppm", KindGauge},
+
+	{"mem.sys.Sys", "Bytes of memory obtained from the OS", "bytes", KindGauge},
+	{"mem.sys.Lookups", "Pointer lookups performed by the runtime", "lookups", KindCounter},
+	{"mem.sys.OtherSys", "Bytes of miscellaneous off-heap runtime allocations", "bytes", KindGauge},
+	{"mem.sys.BuckHashSys", "Bytes of memory in profiling bucket hash tables", "bytes", KindGauge},
+
+	{"mem.com.Total_VM_Bytes_Reserved", "Bytes of memory obtained from the OS", "bytes", KindGauge},
+	{"mem.com.Live_Heap_Bytes_Allocated", "Bytes of allocated heap objects", "bytes", KindGauge},
+	{"mem.com.Cumulative_Heap_Bytes_Allocated", "Bytes allocated for heap objects, including freed ones", "bytes", KindCounter},
+	{"mem.com.Total_Stack_Allocation", "Bytes of stack memory obtained from the OS", "bytes", KindGauge},
+	{"mem.com.Other_Bytes_Allocation", "Bytes of miscellaneous off-heap runtime allocations", "bytes", KindGauge},
+	{"mem.com.TotalRuntimeBytes", "Bytes of heap, stack, span, cache and GC memory obtained from the OS", "bytes", KindGauge},
+	{"mem.com.EstimatedRSSBytes", "Estimate of the resident runtime memory, Sys less HeapReleased", "bytes", KindGauge},
+	{"mem.com.AllocRate", "Bytes allocated for heap objects per second over the interval", "bytes per second", KindGauge},
+
+	{"mem.heap.Alloc", "Bytes of allocated heap objects", "bytes", KindGauge},
+	{"mem.heap.TotalAlloc", "Bytes allocated for heap objects, including freed ones", "bytes", KindCounter},
+	{"mem.heap.Mallocs", "Heap objects allocated", "objects", KindCounter},
+	{"mem.heap.Frees", "Heap objects freed", "objects", KindCounter},
+	{"mem.heap.HeapAlloc", "Bytes of allocated heap objects", "bytes", KindGauge},
+	{"mem.heap.HeapSys", "Bytes of heap memory obtained from the OS", "bytes", KindGauge},
+	{"mem.heap.HeapSysDelta", "Growth of HeapSys over the interval, zero when shrinking", "bytes", KindGauge},
+	{"mem.heap.HeapIdle", "Bytes in idle heap spans", "bytes", KindGauge},
+	{"mem.heap.HeapInuse", "Bytes in in-use heap spans", "bytes", KindGauge},
+	{"mem.heap.HeapReleased", "Bytes of physical memory returned to the OS", "bytes", KindGauge},
+	{"mem.heap.HeapObjects", "Allocated heap objects", "objects", KindGauge},
+	{"mem.heap.HeapObjectsDelta", "Growth of the allocated heap objects over the interval, zero when shrinking", "objects", KindGauge},
+	{"mem.heap.MallocRate", "Heap objects allocated per second over the interval", "objects per second", KindGauge},
+	{"mem.heap.FreeRate", "Heap objects freed per second over the interval", "objects per second", KindGauge},
+	{"mem.heap.MallocsPerInterval", "Heap objects allocated over the interval", "objects", KindGauge},
+	{"mem.heap.FreesPerInterval", "Heap objects freed over the interval", "objects", KindGauge},
+	{"mem.heap.UtilizationPPM", "HeapInuse relative to HeapSys, nearing a million shortly before the heap grows", "ppm", KindGauge},
+	{"mem.heap.TurnoverRatioPPM", "TotalAlloc relative to HeapAlloc, the allocation turnover of the live heap", "ppm", KindGauge},
+	{"mem.heap.AvgObjectSizeBytes", "Average size of the allocated heap objects, HeapAlloc over HeapObjects", "bytes", KindGauge},
+	{"mem.heap.RetainedIdle", "Bytes of idle heap spans not yet returned to the OS", "bytes", KindGauge},
+	{"mem.heap.ReleaseEfficiencyPPM", "HeapReleased relative to HeapIdle, averaged over the passes since start", "ppm", KindGauge},
+	{"mem.heap.ForcedReleaseBytes", "Bytes returned to the OS over an interval with a forced GC, such as by debug.FreeOSMemory", "bytes", KindGauge},
+	{"mem.heap.BackgroundReleaseBytes", "Bytes returned to the OS by the background scavenger over the interval", "bytes", KindGauge},
+
+	{"mem.stack.StackSys", "Bytes of stack memory obtained from the OS", "bytes", KindGauge},
+	{"mem.stack.StackInuse", "Bytes in stack spans", "bytes", KindGauge},
+	{"mem.stack.MSpanInuse", "Bytes of allocated mspan structures", "bytes", KindGauge},
+	{"mem.stack.MSpanSys", "Bytes of memory obtained from the OS for mspan structures", "bytes", KindGauge},
+	{"mem.stack.MSpanSlack", "Bytes obtained for mspan structures but unused", "bytes", KindGauge},
+	{"mem.stack.MCacheInuse", "Bytes of allocated mcache structures", "bytes", KindGauge},
+	{"mem.stack.MCacheSys", "Bytes of memory obtained from the OS for mcache structures", "bytes", KindGauge},
+	{"mem.stack.MCacheSlack", "Bytes obtained for mcache structures but unused", "bytes", KindGauge},
+	{"mem.stack.MSpanInuseDelta", "Growth of MSpanInuse over the interval, zero when shrinking", "bytes", KindGauge},
+	{"mem.stack.MCacheInuseDelta", "Growth of MCacheInuse over the interval, zero when shrinking", "bytes", KindGauge},
+
+	{"mem.os.RSSBytes", "Resident set size reported by the OS, with EnableOSMem", "bytes", KindGauge},
+	{"mem.os.VSizeBytes", "Virtual memory size reported by the OS, with EnableOSMem", "bytes", KindGauge},
+
+	{"mem.gc.GCSys", "Bytes of memory in garbage collection metadata", "bytes", KindGauge},
+	{"mem.gc.NextGC", "Target heap size of the next GC cycle", "bytes", KindGauge},
+	{"mem.gc.LastGC", "Time the last garbage collection finished, since the Unix epoch", "nanoseconds", KindGauge},
+	{"mem.gc.PauseTotalNs", "Cumulative time spent in GC stop-the-world pauses", "nanoseconds", KindCounter},
+	{"mem.gc.Pause", "Duration of the latest GC stop-the-world pause", "nanoseconds", KindTimer},
+	{"mem.gc.Pause.p50", "Median GC stop-the-world pause over the interval, on intervals with a GC", "nanoseconds", KindGauge},
+	{"mem.gc.Pause.p95", "95th percentile GC stop-the-world pause over the interval, on intervals with a GC", "nanoseconds", KindGauge},
+	{"mem.gc.Pause.p99", "99th percentile GC stop-the-world pause over the interval, on intervals with a GC", "nanoseconds", KindGauge},
+	{"mem.gc.Pause.max", "Longest GC stop-the-world pause over the interval, on intervals with a GC", "nanoseconds", KindGauge},
+	{"mem.gc.NumGC", "Completed GC cycles", "cycles", KindCounter},
+	{"mem.gc.NumGCPerInterval", "GC cycles completed over the interval, as a gauge", "cycles", KindGauge},
+	{"mem.gc.PauseCount", "GC cycles completed over the interval", "cycles", KindCounter},
+	{"mem.gc.PauseSumNs", "Time spent in GC pauses over the interval", "nanoseconds", KindCounter},
+	{"mem.gc.PauseIntervalTotalNs", "Time spent in GC pauses over the interval, as a gauge", "nanoseconds", KindGauge},
+	{"mem.gc.NextGCRatioPPM", "NextGC relative to HeapAlloc, the heap growth before the next cycle", "ppm", KindGauge},
+	{"mem.gc.NextGCTrend", "Direction of NextGC since the previous pass: 1 up, 0 flat, 2 down", "enum", KindGauge},
+	{"mem.gc.CycleProgressPPM", "HeapAlloc relative to NextGC, the progress through the current cycle", "ppm", KindGauge},
+	{"mem.gc.HeapGrowthSinceGCBytes", "Growth of HeapAlloc since the first pass after the latest GC cycle", "bytes", KindGauge},
+	{"mem.gc.AllocPerCycleBytes", "Bytes allocated per collection since the previous pass, zero without any", "bytes", KindGauge},
+	{"mem.gc.LastPauseVsAvgPPM", "Latest GC pause relative to the average pause", "ppm", KindGauge},
+	{"mem.gc.Disabled", "1 if the GC is turned off by GOGC=off or debug.SetGCPercent(-1)", "boolean", KindGauge},
+	{"mem.gc.Goal", "Heap size the GC aims to collect at, from runtime/metrics and NextGC before", "bytes", KindGauge},
+	{"mem.gc.Live", "Heap bytes marked live by the last collection, from runtime/metrics on Go 1.21 and later", "bytes", KindGauge},
+	{"mem.gc.GoalVsLimitPPM", "NextGC relative to the soft memory limit, when GOMEMLIMIT is set", "ppm", KindGauge},
+	{"mem.gc.Pressure", "Composite GC pressure score, from 0 to 1000", "score", KindGauge},
+	{"mem.gc.Pressure.Frequency", "GC frequency component of the pressure score", "score", KindGauge},
+	{"mem.gc.Pressure.Pause", "Pause fraction component of the pressure score", "score", KindGauge},
+	{"mem.gc.Pressure.Headroom", "Heap headroom component of the pressure score", "score", KindGauge},
+	{"mem.Pressure", "1 while the GC rate, pause fraction or memory limit headroom crosses the MemPressure thresholds", "boolean", KindGauge},
+	{"mem.gc.cpu.MarkAssistNs", "Cumulative CPU time goroutines spent assisting the GC, with EnableGCCPUMetrics", "nanoseconds", KindCounter},
+	{"mem.gc.cpu.MarkDedicatedNs", "Cumulative CPU time of dedicated GC mark workers, with EnableGCCPUMetrics", "nanoseconds", KindCounter},
+	{"mem.gc.cpu.MarkIdleNs", "Cumulative CPU time of idle GC mark workers, with EnableGCCPUMetrics", "nanoseconds", KindCounter},
+	{"mem.gc.cpu.PauseNs", "Cumulative CPU time spent with the world stopped by the GC, with EnableGCCPUMetrics", "nanoseconds", KindCounter},
+	{"mem.gc.cpu.TotalNs", "Cumulative CPU time spent on the GC, with EnableGCCPUMetrics", "nanoseconds", KindCounter},
+	{"mem.gc.cpu.AssistSharePPM", "Share of the GC marking CPU time spent in assists over the interval, with EnableGCCPUMetrics", "ppm", KindGauge},
+	{"mem.gc.finalizer.Queued", "Finalizers queued to run, on Go 1.25 and later", "finalizers", KindGauge},
+	{"mem.gc.finalizer.Executed", "Finalizers run, on Go 1.25 and later", "finalizers", KindGauge},
+	{"mem.gc.finalizer.Backlog", "Finalizers queued but not yet run, on Go 1.25 and later", "finalizers", KindGauge},
+	{"mem.gc.finalizer.CleanupsQueued", "Cleanups queued to run, on Go 1.25 and later", "cleanups", KindGauge},
+	{"mem.gc.finalizer.CleanupsExecuted", "Cleanups run, on Go 1.25 and later", "cleanups", KindGauge},
+	{"mem.gc.finalizer.CleanupsBacklog", "Cleanups queued but not yet run, on Go 1.25 and later", "cleanups", KindGauge},
+}
@@ -0,0 +1,72 @@
+package gostats
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withEveryMetric enables every option adding built-in metrics for the
+// duration of the test.
+func withEveryMetric(t *testing.T) {
+	t.Helper()
+	emitClock, emitDuration, emitSequence := EmitClock, EmitCollectDuration, EmitSequence
+	osMem, block, mutex := EnableOSMem, EnableBlockProfile, EnableMutexProfile
+	gcCPU, sched, created := EnableGCCPUMetrics, EnableSchedLatency, EnableGoroutinesCreated
+	schedStats := SchedStats
+	deltaMode, breaker, backoff, series, clock := DeltaMode, BreakerFailures, RestartBackoff, MaxSeries, ClockReference
+	t.Cleanup(func() {
+		EmitClock, EmitCollectDuration, EmitSequence = emitClock, emitDuration, emitSequence
+		EnableOSMem, EnableBlockProfile, EnableMutexProfile = osMem, block, mutex
+		EnableGCCPUMetrics, EnableSchedLatency, EnableGoroutinesCreated = gcCPU, sched, created
+		SchedStats = schedStats
+		DeltaMode, BreakerFailures, RestartBackoff, MaxSeries, ClockReference = deltaMode, breaker, backoff, series, clock
+	})
+
+	EmitClock, EmitCollectDuration, EmitSequence = true, true, true
+	EnableOSMem, EnableBlockProfile, EnableMutexProfile = true, true, true
+	EnableGCCPUMetrics, EnableSchedLatency, EnableGoroutinesCreated = true, true, true
+	SchedStats = true
+	DeltaMode = AbsoluteAndDelta
+	BreakerFailures = 3
+	RestartBackoff = time.Second
+	MaxSeries = 1 << 20
+	ClockReference = func() (time.Time, error) { return time.Now(), nil }
+}
+
+// Described metrics a single pass into a plain sink doesn't output, as they
+// depend on the sink, on GCs between passes or on a memory limit.
+var conditionalMetrics = map[string]bool{
+	"cpu.NumGoroutineMin":   true,
+	"cpu.SinkDropped":       true,
+	"cpu.SinkQueued":        true,
+	"mem.gc.Pause.p50":      true,
+	"mem.gc.Pause.p95":      true,
+	"mem.gc.Pause.p99":      true,
+	"mem.gc.Pause.max":      true,
+	"mem.gc.GoalVsLimitPPM": true,
+}
+
+func TestDescribeMatchesSupportedMetrics(t *testing.T) {
+	withEveryMetric(t)
+	runtime.GC()
+
+	described := make(map[string]bool)
+	for _, d := range Describe() {
+		described[d.Key] = true
+	}
+	supported := make(map[string]bool)
+	for _, key := range SupportedMetrics() {
+		bucket := strings.TrimSuffix(key, ".delta")
+		supported[bucket] = true
+		if !described[bucket] {
+			t.Errorf("%s is output but not described", key)
+		}
+	}
+	for _, d := range Describe() {
+		if !supported[d.Key] && !conditionalMetrics[d.Key] {
+			t.Errorf("%s is described but not output", d.Key)
+		}
+	}
+}
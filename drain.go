@@ -0,0 +1,146 @@
+package gostats
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Drainer is a Sink buffering metrics it sends later, such as BatchingSink
+// or the sinks sending from a goroutine of their own. Drain sends what is
+// buffered, giving up once ctx is done, and returns how many items were
+// sent and how many were dropped for lack of time. Items are metrics for
+// BatchingSink and passes or batches of them for the queued sinks.
+type Drainer interface {
+	Drain(ctx context.Context) (flushed int, dropped int, err error)
+}
+
+// drainRequest asks the collection goroutine to drain the sink.
+type drainRequest struct {
+	ctx   context.Context
+	reply chan drainResult
+}
+
+type drainResult struct {
+	flushed, dropped int
+	err              error
+}
+
+// Drain sends the metrics buffered by the sink of the running collector, if
+// it is a Drainer, waiting at most until ctx is done. It returns the number
+// of items sent and dropped, as counted by the sink. Stop drains the sink
+// too, within ShutdownTimeout, so the last partial batch isn't lost.
+func Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	col := c
+	if col == nil {
+		return 0, 0, errors.New("no collector running")
+	}
+	req := drainRequest{ctx, make(chan drainResult, 1)}
+	select {
+	case col.drains <- req:
+	case <-col.exited:
+		return 0, 0, errors.New("collector stopped")
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	}
+	r := <-req.reply
+	return r.flushed, r.dropped, r.err
+}
+
+// drain drains the sink if it buffers metrics.
+func (c *collector) drain(ctx context.Context) drainResult {
+	d, ok := c.sink.(Drainer)
+	if !ok {
+		return drainResult{}
+	}
+	var r drainResult
+	r.flushed, r.dropped, r.err = d.Drain(ctx)
+	if r.err != nil {
+		c.logger.Error("error draining sink", "error", r.err)
+	} else if r.dropped > 0 {
+		c.logger.Warn("sink not drained in time", "flushed", r.flushed, "dropped", r.dropped)
+	}
+	return r
+}
+
+// drainPoll is how often a drained asyncQueue is checked for being empty.
+const drainPoll = 5 * time.Millisecond
+
+// asyncQueueSize is the number of passes, or batches of them, waiting to be
+// sent by the sinks sending from a goroutine of their own before new ones
+// are dropped.
+const asyncQueueSize = 4
+
+// asyncQueue hands payloads to a goroutine of its own sending them, for the
+// sinks that must not hold up the collection. Payloads that find the queue
+// full are dropped and counted.
+type asyncQueue[T any] struct {
+	queue chan T
+	done  chan struct{}
+
+	// Payloads queued or being sent, and sent so far.
+	pending atomic.Int64
+	sent    atomic.Uint64
+
+	dropped atomic.Uint64
+}
+
+// newAsyncQueue starts the goroutine handing the queued payloads to send.
+func newAsyncQueue[T any](send func(T)) *asyncQueue[T] {
+	q := &asyncQueue[T]{
+		queue: make(chan T, asyncQueueSize),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(q.done)
+		for v := range q.queue {
+			send(v)
+			q.sent.Add(1)
+			q.pending.Add(-1)
+		}
+	}()
+	return q
+}
+
+// push queues v, dropping it if the queue is full.
+func (q *asyncQueue[T]) push(v T) {
+	q.pending.Add(1)
+	select {
+	case q.queue <- v:
+	default:
+		q.pending.Add(-1)
+		q.dropped.Add(1)
+	}
+}
+
+// drain waits for the queued payloads to be sent until ctx is done, then
+// drops those still queued.
+func (q *asyncQueue[T]) drain(ctx context.Context) (flushed int, dropped int, err error) {
+	start := q.sent.Load()
+	tick := time.NewTicker(drainPoll)
+	defer tick.Stop()
+	for q.pending.Load() > 0 {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			for {
+				select {
+				case <-q.queue:
+					q.pending.Add(-1)
+					q.dropped.Add(1)
+					dropped++
+				default:
+					return int(q.sent.Load() - start), dropped, nil
+				}
+			}
+		}
+	}
+	return int(q.sent.Load() - start), 0, nil
+}
+
+// close sends the payloads still queued and stops the goroutine.
+func (q *asyncQueue[T]) close() {
+	close(q.queue)
+	<-q.done
+}
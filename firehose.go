@@ -0,0 +1,134 @@
+package gostats
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// Kinesis Firehose PutRecordBatch limits.
+const (
+	firehoseMaxRecords    = 500
+	firehoseMaxBatchBytes = 4 << 20
+	firehoseMaxRecord     = 1000 << 10
+)
+
+// FirehoseClient puts a batch of records to a Kinesis Firehose delivery
+// stream, typically through PutRecordBatch of the AWS SDK. It is an interface
+// so the package doesn't depend on the SDK; a wrapper of a few lines adapts
+// the SDK client.
+type FirehoseClient interface {
+	PutRecordBatch(ctx context.Context, stream string, records [][]byte) error
+}
+
+// FirehoseSink puts the collection passes, as JSON records in the format of
+// JSONSink, to a Kinesis Firehose delivery stream. Passes are batched up to
+// the PutRecordBatch limits and put every FlushInterval and when the
+// collector stops, from a goroutine of their own so the collection never
+// waits on the stream. Batches that find the queue full are dropped and
+// counted by Dropped, and failed puts are logged.
+type FirehoseSink struct {
+	// FlushInterval is how often the batched passes are put, defaults to a
+	// minute. A batch reaching the PutRecordBatch limits is put right away.
+	FlushInterval time.Duration
+
+	// Timeout bounds every put, defaults to ten seconds.
+	Timeout time.Duration
+
+	client FirehoseClient
+	stream string
+
+	body      bytes.Buffer
+	json      *JSONSink
+	batch     [][]byte
+	size      int
+	lastFlush time.Time
+
+	queue *asyncQueue[[][]byte]
+}
+
+// NewFirehoseSink returns a sink putting to the delivery stream through
+// client, for use with CollectTo.
+func NewFirehoseSink(client FirehoseClient, stream string) *FirehoseSink {
+	s := &FirehoseSink{
+		FlushInterval: time.Minute,
+		Timeout:       10 * time.Second,
+		client:        client,
+		stream:        stream,
+		lastFlush:     time.Now(),
+	}
+	s.json = NewJSONSink(&s.body)
+	s.queue = newAsyncQueue(s.put)
+	return s
+}
+
+func (s *FirehoseSink) Gauge(key string, value uint64) error {
+	return s.json.Gauge(key, value)
+}
+
+func (s *FirehoseSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	return s.json.GaugeAt(key, value, ts)
+}
+
+func (s *FirehoseSink) Flush() error {
+	if err := s.json.Flush(); err != nil {
+		return err
+	}
+	if s.body.Len() == 0 {
+		return nil
+	}
+	record := bytes.Clone(s.body.Bytes())
+	s.body.Reset()
+	if len(record) > firehoseMaxRecord {
+		Logger.Warn("dropping collection pass over the firehose record size limit", "bytes", len(record))
+		return nil
+	}
+
+	if len(s.batch) == firehoseMaxRecords || s.size+len(record) > firehoseMaxBatchBytes {
+		s.enqueue()
+	}
+	s.batch = append(s.batch, record)
+	s.size += len(record)
+	if time.Since(s.lastFlush) >= s.FlushInterval {
+		s.enqueue()
+	}
+	return nil
+}
+
+// enqueue hands the current batch to the putting goroutine.
+func (s *FirehoseSink) enqueue() {
+	s.lastFlush = time.Now()
+	if len(s.batch) == 0 {
+		return
+	}
+	s.queue.push(s.batch)
+	s.batch = nil
+	s.size = 0
+}
+
+// Drain puts the batched passes and waits for the queued puts until ctx is
+// done.
+func (s *FirehoseSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	s.enqueue()
+	return s.queue.drain(ctx)
+}
+
+// Close puts the batched passes and waits for the queued puts.
+func (s *FirehoseSink) Close() error {
+	s.enqueue()
+	s.queue.close()
+	return nil
+}
+
+// Dropped returns the number of batches dropped because the queue was full.
+func (s *FirehoseSink) Dropped() uint64 {
+	return s.queue.dropped.Load()
+}
+
+func (s *FirehoseSink) put(batch [][]byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	if err := s.client.PutRecordBatch(ctx, s.stream, batch); err != nil {
+		Logger.Error("error putting to firehose", "stream", s.stream, "records", len(batch), "error", err)
+	}
+}
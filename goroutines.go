@@ -0,0 +1,43 @@
+package gostats
+
+import "sync"
+
+// Goroutine thresholds registered with OnGoroutineThreshold.
+var (
+	goroutineThresholdsMu sync.Mutex
+	goroutineThresholds   []*goroutineThreshold
+)
+
+// goroutineThreshold is a callback fired once per crossing of n.
+type goroutineThreshold struct {
+	n     int
+	fn    func(count int)
+	above bool
+}
+
+// OnGoroutineThreshold registers fn to be called when the goroutine count
+// output with the CPU statistics rises above n, for example to dump a
+// goroutine profile when a leak shows. It fires once per crossing: the count
+// has to drop back to n or below before fn can fire again. fn is called on a
+// goroutine of its own so it doesn't hold up the collection.
+func OnGoroutineThreshold(n int, fn func(count int)) {
+	goroutineThresholdsMu.Lock()
+	goroutineThresholds = append(goroutineThresholds, &goroutineThreshold{n: n, fn: fn})
+	goroutineThresholdsMu.Unlock()
+}
+
+// checkGoroutineThresholds fires the callbacks whose threshold count crossed.
+func checkGoroutineThresholds(count int) {
+	goroutineThresholdsMu.Lock()
+	defer goroutineThresholdsMu.Unlock()
+
+	for _, t := range goroutineThresholds {
+		switch {
+		case count > t.n && !t.above:
+			t.above = true
+			go t.fn(count)
+		case count <= t.n:
+			t.above = false
+		}
+	}
+}
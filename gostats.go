@@ -1,123 +1,1535 @@
 package gostats
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"math/bits"
 	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Statsd host:port pair
 var Endpoint = "localhost:8125"
 
+// MaxKeyLen is the maximum length of a composed metric key (prefix and
+// bucket), zero means no limit. Keys exceeding it are handled according to
+// LongKeyPolicy.
+var MaxKeyLen = 0
+
+// LongKeyPolicy determines how keys longer than MaxKeyLen are handled.
+var LongKeyPolicy = LongKeyWarn
+
+// KeyPolicy controls the handling of over-long metric keys.
+type KeyPolicy int
+
+const (
+	// LongKeyWarn sends the key unchanged after warning about it.
+	LongKeyWarn KeyPolicy = iota
+
+	// LongKeyTruncate cuts the key down to MaxKeyLen.
+	LongKeyTruncate
+
+	// LongKeyHash cuts the key down to MaxKeyLen, replacing its tail with a
+	// hash of the full key so distinct long keys stay distinct.
+	LongKeyHash
+)
+
+// SuppressUnchanged skips sending a gauge whose value hasn't changed since
+// the previous pass. Some backends expire gauges without fresh data, so
+// unchanged values are still re-sent after MaxSuppressed skipped passes.
+var SuppressUnchanged = false
+
+// MaxSuppressed is the number of consecutive passes an unchanged gauge may be
+// skipped before it is sent again, zero means it is never re-sent.
+var MaxSuppressed = 12
+
+// DialRetries is the number of times dialing the statsd endpoint is retried
+// before Collect gives up, useful when a sidecar agent may not be ready yet.
+var DialRetries = 0
+
+// DialBackoff is the wait before the first dial retry, doubled after every
+// further failed attempt.
+var DialBackoff = 500 * time.Millisecond
+
+// GCMetrics selects which garbage collection gauges are output when GC
+// statistics are enabled. Defaults to all of them.
+var GCMetrics = GCAll
+
+// GCMetric is a set of garbage collection gauges.
+type GCMetric uint
+
+// Selectable garbage collection gauges, named after the mem.gc bucket each
+// one enables along with the gauges derived from it: GCNextGC selects
+// mem.gc.NextGCRatioPPM, mem.gc.NextGCTrend and mem.gc.CycleProgressPPM,
+// GCNumGC the per collection ones, GCPauseTotalNs the pause time of the
+// interval, GCPause mem.gc.LastPauseVsAvgPPM and GCGoal
+// mem.gc.GoalVsLimitPPM.
+const (
+	GCSys GCMetric = 1 << iota
+	GCNextGC
+	GCLastGC
+	GCPauseTotalNs
+
+	// GCPause also selects the percentiles and maximum of the pauses since
+	// the previous pass, mem.gc.Pause.p50 to mem.gc.Pause.max.
+	GCPause
+	GCNumGC
+
+	// GCGoal and GCLive select mem.gc.Goal and mem.gc.Live, the heap goal
+	// and the heap marked live by the last collection as runtime/metrics
+	// reports them, more precisely than MemStats.
+	GCGoal
+	GCLive
+
+	// GCCPUFraction selects cpu.GCCPUFraction, output with SchedStats.
+	GCCPUFraction
+
+	GCAll = GCSys | GCNextGC | GCLastGC | GCPauseTotalNs | GCPause | GCNumGC | GCGoal | GCLive | GCCPUFraction
+)
+
+// EmitOnStart makes the collector output a pass as soon as it starts, for a
+// fast first data point. When false the first output happens on the first
+// tick, keeping every output on the interval cadence. Defaults to true.
+var EmitOnStart = true
+
+// ShutdownTimeout bounds how long Stop may spend on the final flush of zero
+// gauges, again on draining a sink buffering metrics, and again on closing
+// the sink while it completes its sends in flight, so a wedged backend can't
+// hang shutdown. Stop returns once all of it is done or timed out.
+var ShutdownTimeout = 2 * time.Second
+
+// GoroutineSamples is how many times per interval the goroutine count is
+// sampled to track cpu.NumGoroutineMax, each sample waking the collector on
+// a timer of its own. Spikes shorter than the sampling period can still be
+// missed. Defaults to 0, sampling only on the pass itself, which makes
+// cpu.NumGoroutineMax the same as cpu.NumGoroutine.
+var GoroutineSamples = 0
+
+// Logger receives the collector diagnostics, such as dial and send errors.
+// Events use the attribute keys endpoint, protocol, key, error and
+// dropped_count. Defaults to discarding everything.
+var Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// DeltaMode selects how monotonically increasing counters, such as
+// mem.heap.Mallocs, are output. The increase output by the first pass, with
+// no previous one to compare against, is zero. Defaults to AbsoluteOnly.
+var DeltaMode = AbsoluteOnly
+
+// CounterMode controls the output of monotonically increasing counters.
+type CounterMode int
+
+const (
+	// AbsoluteOnly outputs the cumulative value under the key.
+	AbsoluteOnly CounterMode = iota
+
+	// DeltaOnly outputs the increase since the previous pass under key.delta.
+	DeltaOnly
+
+	// AbsoluteAndDelta outputs both the cumulative value and the increase.
+	AbsoluteAndDelta
+)
+
+// RecoverPanics makes the collector recover from panics raised during a
+// collection pass, for example by a custom Sink, logging them and carrying on
+// with the next pass. Set it to false to let such panics crash the program.
+var RecoverPanics = true
+
+// OnShutdown selects what Stop sends for every gauge before the collector
+// exits. Defaults to ShutdownZero.
+var OnShutdown = ShutdownZero
+
+// ShutdownMode is the final output made by a stopping collector.
+type ShutdownMode int
+
+const (
+	// ShutdownZero resets every gauge to zero.
+	ShutdownZero ShutdownMode = iota
+
+	// ShutdownSticky sends the last value of every gauge once more, for
+	// backends where the last value should persist.
+	ShutdownSticky
+
+	// ShutdownNone sends nothing.
+	ShutdownNone
+)
+
+// GCPressure configures the mem.gc.Pressure score.
+var GCPressure = PressureWeights{
+	Frequency:        1,
+	PauseFraction:    1,
+	Headroom:         1,
+	MaxGCPerSecond:   10,
+	MaxPauseFraction: 0.05,
+}
+
+// PressureWeights configures the composite GC pressure score, a single 0 to
+// 1000 signal of how much the garbage collector is hurting the program. It
+// is the weighted average of three components, each scaled to 0 to 1000 and
+// also output on its own:
+//
+//	mem.gc.Pressure.Frequency: collections per second over MaxGCPerSecond
+//	mem.gc.Pressure.Pause:     fraction of the interval paused over MaxPauseFraction
+//	mem.gc.Pressure.Headroom:  HeapAlloc over NextGC, how close the heap is to its goal
+//
+// Components are capped at 1000, a zero weight leaves a component out.
+type PressureWeights struct {
+	Frequency     float64
+	PauseFraction float64
+	Headroom      float64
+
+	// Collection rate and pause fraction considered maximal pressure.
+	MaxGCPerSecond   float64
+	MaxPauseFraction float64
+}
+
+// MemPressure configures mem.Pressure.
+var MemPressure = PressureThresholds{
+	GCPerSecond:   2,
+	PauseFraction: 0.02,
+	LimitHeadroom: 0.1,
+}
+
+// PressureThresholds configures mem.Pressure, a single actionable signal
+// that the process is memory stressed: it is 1 while any of the thresholds
+// is crossed over the interval, 0 otherwise. It complements the individual
+// metrics and the mem.gc.Pressure score rather than replacing them. A zero
+// threshold is never crossed.
+type PressureThresholds struct {
+	// GCPerSecond is the collection rate above which the GC is considered
+	// to be running too often.
+	GCPerSecond float64
+
+	// PauseFraction is the fraction of the interval spent in GC pauses
+	// above which the pauses are considered hurting.
+	PauseFraction float64
+
+	// LimitHeadroom is the fraction of the soft memory limit, when one is
+	// set, below which the memory left is considered too little. The
+	// memory counted against the limit is approximated by Sys less
+	// HeapReleased.
+	LimitHeadroom float64
+}
+
+// CPUInterval, when positive, outputs the CPU statistics on their own
+// interval instead of the collection one, typically a shorter one since they
+// are cheap to gather.
+var CPUInterval time.Duration
+
+// MemInterval, when positive, outputs the memory statistics on their own
+// interval instead of the collection one, typically a longer one since
+// reading them stops the world. Garbage collection statistics are derived
+// from the same read and follow this interval too. The CPU statistics are
+// still output on every tick of the collection interval, so goroutine leaks
+// are caught at the fast cadence even when memory is read rarely.
+var MemInterval time.Duration
+
+// Trigger, when set, makes the collector output a pass of every section on
+// each receive, in addition to those of the intervals, for collecting
+// right after an event such as handling a batch of requests. Closing it
+// stops the triggered passes. MinMemInterval doesn't apply to them, so
+// triggering faster than it reads the memory statistics just as fast. A
+// collector and its clones share the channel, each receive triggering only
+// one of them.
+var Trigger <-chan struct{}
+
+// MinMemInterval is the shortest interval memory statistics are read on, as
+// the stop-the-world cost of reading them can dominate the CPU use of a
+// program at very short intervals. Collectors started with memory statistics
+// enabled clamp shorter intervals up to it, logging a warning. Those enabling
+// them later through SetEnabled skip the memory passes coming sooner.
+var MinMemInterval = 100 * time.Millisecond
+
+// AllowFastInterval lifts the MinMemInterval floor.
+var AllowFastInterval = false
+
+// MaxValue, when positive, caps every value sent, guarding dashboards
+// against the occasional absurd spike of a derived metric. Capped values are
+// logged.
+var MaxValue uint64 = 0
+
+// Transform, when set, is called with the full key, prefix included, and
+// value of every metric right before it is sent. It may rewrite both or drop
+// the metric by returning false, covering renaming, filtering and unit
+// scaling. MaxKeyLen and MaxValue apply to what it returns.
+var Transform func(key string, value uint64) (newKey string, newValue uint64, keep bool)
+
+// EmitClock makes the collector output its view of the wall clock as
+// cpu.WallClockUnixMs with the CPU statistics.
+var EmitClock = false
+
+// EmitCollectDuration makes the collector output how long the previous pass
+// took as cpu.CollectDurationNs with the CPU statistics. Prometheus sinks
+// get it as go_stats_collect_duration_seconds regardless.
+var EmitCollectDuration = false
+
+// ClockReference, when set, is queried with the CPU statistics for a trusted
+// time, such as one obtained over NTP, to output the drift of the wall clock
+// from it: cpu.ClockDriftMs holds the absolute drift and cpu.ClockAhead is 1
+// if the local clock is ahead of the reference.
+var ClockReference func() (time.Time, error)
+
+// EmitSequence makes the collector output cpu.CollectSeq, a number counting
+// the collection passes up from 1, with every pass whichever sections it
+// covers. Gaps in it downstream measure the passes lost on the way, such as
+// dropped UDP packets. The count starts over when the collector is
+// restarted, showing as a drop back to 1 rather than a gap.
+var EmitSequence = false
+
+// ThresholdsAbove and ThresholdsBelow restrict metrics, keyed by the full
+// key as sent, to be sent only while their value is above or below the
+// bound, reducing the output to breaches for alerting focused setups. A key
+// in both is sent while either bound is crossed, metrics in neither are
+// always sent. Continuous charting of a restricted metric isn't possible as
+// nothing is sent while it is within bounds.
+var (
+	ThresholdsAbove map[string]uint64
+	ThresholdsBelow map[string]uint64
+)
+
+// BreakerFailures, when positive, pauses collection after that many
+// consecutive failed sends, sparing the stop-the-world memory statistics
+// reads while the sink is down. Collection resumes after BreakerBackoff with
+// a probing pass, the breaker opening again if that pass fails too.
+// cpu.BreakerTrips counts how many times it opened.
+var BreakerFailures = 0
+
+// BreakerBackoff is how long collection pauses once the breaker opens.
+var BreakerBackoff = 30 * time.Second
+
+// RestartBackoff, when positive, makes the collector restart collecting
+// after that long, with the same configuration, when it stops on its own:
+// once it gave up on the sink after BreakerMaxTrips, or on a panic of the
+// collection goroutine that RecoverPanics left alone, which is then
+// recovered and logged rather than crashing the process.
+// cpu.CollectorRestarts counts the restarts. Stop and RunContext work as
+// usual.
+var RestartBackoff time.Duration
+
+// BreakerMaxTrips, when positive, makes the collector give up for good once
+// the breaker has opened that many times in a row without the sink
+// recovering, RunContext then returning ErrSinkFailed. The final output is
+// skipped, the sink being unreachable.
+var BreakerMaxTrips = 0
+
+// ErrSinkFailed is returned by RunContext when the collector gave up on a
+// failing sink after BreakerMaxTrips.
+var ErrSinkFailed = errors.New("sink failed")
+
+// StableOrder sends the metrics of every pass sorted by key, at the end of
+// the pass, rather than in the order they are collected. The output is then
+// stable whichever sections are enabled, making diffs and golden files of it
+// practical.
+var StableOrder = false
+
+// WarmupIntervals suppresses delta and rate metrics, such as the .delta keys
+// and mem.heap.MallocRate, for that many intervals after the collector
+// starts, so the first ones reported are based on a full interval rather
+// than a short or missing baseline. Absolute gauges aren't affected.
+var WarmupIntervals = 0
+
+// MaxSeries bounds the number of distinct keys ever sent, zero means no
+// limit. Once reached, metrics with new keys are dropped and
+// cpu.SeriesBudgetExceeded is raised to 1, protecting the backend from an
+// accidental high cardinality configuration.
+var MaxSeries = 0
+
+// GoldenSignalsOnly limits the built-in metrics to the few most teams alert
+// on, listed in goldenSignals: the goroutine count, the live and reserved
+// heap, the GC frequency and pause time over the interval and the RSS
+// estimate. Metrics from runtime/metrics, registered structs, constants
+// and sources are sent as configured.
+var GoldenSignalsOnly = false
+
+// goldenSignals are the built-in buckets sent with GoldenSignalsOnly.
+var goldenSignals = map[string]bool{
+	"cpu.NumGoroutine":          true,
+	"mem.heap.HeapAlloc":        true,
+	"mem.heap.HeapSys":          true,
+	"mem.gc.PauseCount":         true,
+	"mem.gc.PauseSumNs":         true,
+	"mem.com.EstimatedRSSBytes": true,
+}
+
+// seriesBudgetBucket is always sent, even once the series budget is reached.
+const seriesBudgetBucket = "cpu.SeriesBudgetExceeded"
+
 // collector
 var c *collector = nil
 
 // Collector implements the periodic grabbing of informational data from the
 // runtime package and outputting it to statsd.
 type collector struct {
-	// PauseDur represents the interval between each set of stats output.
-	// Defaults to 5 seconds.
-	pauseDur time.Duration
+	settings
 
 	// EnableCPU determines whether CPU statistics will be output. Defaults to true.
-	enableCPU bool
+	enableCPU atomic.Bool
 
 	// EnableMem determines whether memory statistics will be output. Defaults to true.
-	enableMem bool
+	enableMem atomic.Bool
 
 	// EnableGC determines whether garbage collection statistics will be output. EnableMem
 	// must also be set to true for this to take affect. Defaults to true.
-	enableGC bool
+	enableGC atomic.Bool
+
+	// Shortest time between memory passes, set once memory statistics are
+	// enabled on a collector already ticking faster than minMemInterval.
+	memFloor atomic.Int64
+
+	// Bucket prefix, and the parts of the key around the bucket derived
+	// from it or the key template.
+	prefix  string
+	keyHead string
+	keyTail string
+
+	// Destination of the collected metrics
+	sink Sink
+
+	// Start of the current collection pass, shared by all of its metrics.
+	passTime time.Time
+
+	// Recent passes, nil if disabled, and the values of the current pass.
+	history *history
+	pass    Snapshot
+
+	// Result of the check of runtime.ReadMemStats made before the first
+	// memory pass, 1 if healthy.
+	memStatsHealthy uint64
+	memStatsChecked bool
+
+	// Number of keys a pass outputs, counted over the first passes until
+	// every section was output, and the count so far.
+	metricsAvailable uint64
+	countedSections  section
+	countedKeys      uint64
+	passKeys         uint64
+
+	// Highest goroutine count sampled since the last output.
+	goroutineMax uint64
+
+	// Fewest and most goroutines over the window of a windowSink.
+	windowMin, windowMax uint64
+
+	// CPU statistics of the previous pass, nil on the first pass.
+	prevCPU *CPUStats
+
+	// Statistics are read into these in turn, leaving the previous pass
+	// ones intact without allocating on every pass.
+	cpuBufs [2]CPUStats
+	memBufs [2]runtime.MemStats
+
+	// Full key of every bucket, and of its delta, composed once.
+	keyCache   map[string]string
+	deltaNames map[string]string
+
+	// Sliding windows of the smoothed metrics.
+	windows map[string]*smoothWindow
+
+	// Memory statistics of the previous pass, the monotonic clock reading
+	// it was taken at and the time elapsed since, used for rates. prevMem
+	// is nil on the first pass.
+	prevMem    *runtime.MemStats
+	prevMemAt  time.Duration
+	memElapsed time.Duration
+
+	// Reads the monotonic clock the rates are measured with.
+	monotonic func() time.Duration
+
+	// Scratch buffer the GC pauses of the interval are sorted in.
+	pauses []uint64
+
+	// HeapAlloc of the first pass after the latest GC cycle, the baseline
+	// the heap grows from toward NextGC.
+	postGCHeapAlloc uint64
+
+	// Every gauge delivered so far, in the order first delivered, for the
+	// shutdown flush, and the last value of every gauge sent, delivered or
+	// held back.
+	keys      []string
+	delivered map[string]bool
+	lastValue map[string]uint64
+
+	// Shutdown signaling, done is closed by stop and exited once run returns.
+	done     chan struct{}
+	exited   chan struct{}
+	stopOnce sync.Once
+
+	// MemStats handed in by OutputFrom, acknowledged on fromDone once output.
+	from     chan *runtime.MemStats
+	fromDone chan struct{}
+
+	// Requests of Drain.
+	drains chan drainRequest
+
+	// Requests of SupportedMetrics, answered with the keys of a pass.
+	keyRequests chan chan map[string]bool
+
+	// Set by Pause, skipping the passes until Resume.
+	paused atomic.Bool
+
+	// Over-long keys already warned about, so each is reported once, and
+	// what they are sent as.
+	longKeys map[string]string
+
+	// Keys admitted within the series budget and whether it was exceeded.
+	series         map[string]struct{}
+	seriesExceeded bool
+
+	// Last sent value of each key, for unchanged gauge suppression.
+	lastSent map[string]*sentValue
+
+	// Runtime metrics samples, allocated on first use.
+	runtimeMetrics   *runtimeMetrics
+	gcCPU            *runtimeSet
+	finalizers       *runtimeSet
+	schedLatency     *schedLatency
+	histogramBuckets *bucketedHistograms
+
+	// send as a GaugeFunc for sources, kept to avoid allocating it per pass.
+	gaugeFunc GaugeFunc
+
+	// Passes made of the CPU and memory sections, and whether the section
+	// being output is still warming up.
+	cpuPasses int
+	memPasses int
+
+	// Sum of the released share of the idle heap, in ppm, over the passes
+	// finding idle heap, for mem.heap.ReleaseEfficiencyPPM.
+	releasePPMSum uint64
+	releasePasses uint64
+	warming       bool
+
+	// Goroutines created as of the previous pass, with
+	// EnableGoroutinesCreated.
+	prevGoroutinesCreated uint64
+
+	// Contention profiles read with EnableBlockProfile and
+	// EnableMutexProfile.
+	blockProfile profileTotals
+	mutexProfile profileTotals
+
+	// Sequence number of the current pass, with EmitSequence.
+	seq uint64
+
+	// Keys and scratch space of BySize, nil until first used.
+	bySizeStats *bySizeStats
+
+	// CPU statistics given to OutputStats, used instead of reading them.
+	cpuFrom *CPUStats
+
+	// Metrics of the current pass held to be sent in sorted order.
+	ordered []pendingMetric
+
+	// Circuit breaker state, consecutive failed sends and when an open
+	// breaker lets a probing pass through.
+	failures     int
+	breakerUntil time.Time
+
+	// Breaker openings since the sink last recovered, and the error the
+	// collector gave up with after BreakerMaxTrips of them.
+	trips int
+	fatal error
+
+	// Self-diagnostics, reported by Stats.
+	diag diagnostics
+
+	// Reader of the OS memory stats.
+	osMem osMemReader
+
+	// CPU quota of the cgroup, Linux only.
+	cgroupCPU cgroupCPUReader
+
+	// Heap bytes allocated during the previous pass, and the sample single
+	// runtime/metrics values are read through.
+	sample     [1]metrics.Sample
+	passAllocs uint64
+}
+
+// pendingMetric is a metric held until the end of the pass.
+type pendingMetric struct {
+	key     string
+	value   uint64
+	counter bool
+}
+
+// sentValue is the last value sent for a key and how many passes it has been
+// suppressed since.
+type sentValue struct {
+	value   uint64
+	skipped int
+}
+
+// settings is the configuration of a collector, as opposed to its running
+// state.
+type settings struct {
+	// PauseDur represents the interval between each set of stats output.
+	// Defaults to 5 seconds.
+	pauseDur time.Duration
+
+	// Output a pass immediately on start.
+	emitOnStart bool
+
+	// Separate intervals of the CPU and memory sections, zero when they
+	// follow pauseDur.
+	cpuInterval time.Duration
+	memInterval time.Duration
+
+	// MinMemInterval, zero with AllowFastInterval.
+	minMemInterval time.Duration
+
+	// Passes on demand, nil when disabled.
+	trigger <-chan struct{}
+
+	// GCMetrics selects the garbage collection gauges to output.
+	gcMetrics GCMetric
+
+	// Diagnostics logger
+	logger *slog.Logger
+
+	// Number of passes kept in the history, zero disables it.
+	historySize int
+
+	// Key template and its custom placeholders.
+	keyTemplate    string
+	templateValues map[string]string
+
+	// Append the binary name to the prefix.
+	includeBinaryName bool
+
+	// Built-in metrics limited to the golden signals.
+	goldenSignalsOnly bool
+
+	// Naming scheme and short names of the metrics.
+	keyScheme   Scheme
+	compactKeys bool
+
+	// Send the metrics of every pass sorted by key.
+	stableOrder bool
+
+	// Rewrites composed keys for the backend.
+	sanitize func(key string) string
+
+	// Output the OS memory stats.
+	enableOSMem bool
+
+	// Maximum key length and the policy applied to longer keys.
+	maxKeyLen     int
+	longKeyPolicy KeyPolicy
+
+	// Cap on values sent, zero for none.
+	maxValue uint64
+
+	// Maximum number of distinct keys sent, zero for none.
+	maxSeries int
+
+	// Passes deltas and rates are suppressed for after starting.
+	warmupIntervals int
+
+	// Consecutive send failures opening the circuit breaker, zero for none,
+	// and how long it stays open.
+	breakerFailures int
+	breakerBackoff  time.Duration
+	breakerMaxTrips int
+
+	// Delay before restarting a collector that stopped on its own, zero
+	// for none.
+	restartBackoff time.Duration
+
+	// Bounds outside which restricted metrics are sent.
+	thresholdsAbove map[string]uint64
+	thresholdsBelow map[string]uint64
 
-	// Bucket prefix
-	prefix string
+	// Rewrites or drops metrics before they are sent.
+	transform func(key string, value uint64) (string, uint64, bool)
 
-	// Connection handler
-	conn net.Conn
+	// Goroutine count samples per interval for the high-water mark.
+	goroutineSamples int
+
+	// Recover from panics raised by a collection pass.
+	recoverPanics bool
+
+	// Wall clock output and the reference it is compared with.
+	emitClock bool
+
+	// EmitCollectDuration determines whether cpu.CollectDurationNs is
+	// output.
+	emitCollectDuration bool
+	clockReference      func() (time.Time, error)
+
+	// Pass sequence number output.
+	emitSequence bool
+
+	// Destination of the whole memory statistics of every pass.
+	rawMemStats io.Writer
+
+	// Live objects per size class, limited to the top classes if positive.
+	bySize     bool
+	bySizeTopN int
+
+	// Weighting of the GC pressure score, and thresholds of the memory
+	// pressure indicator.
+	gcPressure  PressureWeights
+	memPressure PressureThresholds
+
+	// Output of the monotonic counters.
+	deltaMode CounterMode
+
+	// Final output on shutdown and the time it may take.
+	shutdownMode    ShutdownMode
+	shutdownTimeout time.Duration
+
+	// Unchanged gauge suppression.
+	suppressUnchanged bool
+	maxSuppressed     int
+
+	// EnableAllRuntimeMetrics determines whether every runtime/metrics
+	// metric will be output. Defaults to false.
+	enableAllRuntimeMetrics bool
+
+	// EnableGCCPUMetrics determines whether GC CPU time will be output.
+	// Defaults to false.
+	enableGCCPU bool
+
+	// EnableSchedLatency determines whether scheduling latency will be
+	// output along with the CPU statistics. Defaults to false.
+	enableSchedLatency bool
+
+	// SchedStats determines whether GOMAXPROCS, the scheduling latency and
+	// the GC CPU fraction will be output. Defaults to false.
+	schedStats bool
+
+	// EnableGoroutinesCreated determines whether the goroutines created
+	// will be output along with the CPU statistics. Defaults to false.
+	enableGoroutinesCreated bool
+
+	// EnableBlockProfile determines whether the block profile totals will
+	// be output along with the CPU statistics. Defaults to false.
+	enableBlockProfile bool
+
+	// EnableMutexProfile determines whether the mutex profile totals will
+	// be output along with the CPU statistics. Defaults to false.
+	enableMutexProfile bool
+
+	// Runtime histograms to output bucket by bucket.
+	histogramSelection map[string][]float64
+
+	// Window sizes of the smoothed metrics.
+	smooth map[string]int
+}
+
+// packageSettings returns the settings configured through the package
+// variables.
+func packageSettings() settings {
+	return settings{
+		pauseDur:                5 * time.Second,
+		emitOnStart:             EmitOnStart,
+		cpuInterval:             CPUInterval,
+		memInterval:             MemInterval,
+		minMemInterval:          minMemInterval(),
+		trigger:                 Trigger,
+		gcMetrics:               GCMetrics,
+		logger:                  Logger,
+		historySize:             HistorySize,
+		keyTemplate:             KeyTemplate,
+		templateValues:          KeyTemplateValues,
+		includeBinaryName:       IncludeBinaryName,
+		compactKeys:             CompactKeys,
+		keyScheme:               KeyScheme,
+		goldenSignalsOnly:       GoldenSignalsOnly,
+		stableOrder:             StableOrder,
+		sanitize:                Sanitize,
+		enableOSMem:             EnableOSMem,
+		maxKeyLen:               MaxKeyLen,
+		longKeyPolicy:           LongKeyPolicy,
+		maxValue:                MaxValue,
+		maxSeries:               MaxSeries,
+		warmupIntervals:         WarmupIntervals,
+		breakerFailures:         BreakerFailures,
+		breakerBackoff:          BreakerBackoff,
+		breakerMaxTrips:         BreakerMaxTrips,
+		restartBackoff:          RestartBackoff,
+		thresholdsAbove:         ThresholdsAbove,
+		thresholdsBelow:         ThresholdsBelow,
+		transform:               Transform,
+		goroutineSamples:        GoroutineSamples,
+		recoverPanics:           RecoverPanics,
+		emitClock:               EmitClock,
+		emitCollectDuration:     EmitCollectDuration,
+		clockReference:          ClockReference,
+		emitSequence:            EmitSequence,
+		bySize:                  BySize,
+		rawMemStats:             RawMemStats,
+		bySizeTopN:              BySizeTopN,
+		gcPressure:              GCPressure,
+		memPressure:             MemPressure,
+		deltaMode:               DeltaMode,
+		shutdownMode:            OnShutdown,
+		shutdownTimeout:         ShutdownTimeout,
+		suppressUnchanged:       SuppressUnchanged,
+		maxSuppressed:           MaxSuppressed,
+		enableAllRuntimeMetrics: EnableAllRuntimeMetrics,
+		enableGCCPU:             EnableGCCPUMetrics,
+		enableSchedLatency:      EnableSchedLatency,
+		schedStats:              SchedStats,
+		enableGoroutinesCreated: EnableGoroutinesCreated,
+		enableBlockProfile:      EnableBlockProfile,
+		enableMutexProfile:      EnableMutexProfile,
+		histogramSelection:      HistogramBuckets,
+		smooth:                  Smooth,
+	}
 }
 
 // New creates a new Collector that will periodically output statistics to send.
-func newCollector(prefix string, conn net.Conn) *collector {
-	return &collector{
-		pauseDur:  5 * time.Second,
-		enableCPU: true,
-		enableMem: true,
-		enableGC:  true,
-		prefix:    prefix,
-		conn:      conn,
+func newCollector(prefix string, sink Sink, s settings) *collector {
+	c := &collector{
+		settings:    s,
+		prefix:      prefix,
+		sink:        sink,
+		delivered:   make(map[string]bool),
+		lastValue:   make(map[string]uint64),
+		keyCache:    make(map[string]string),
+		done:        make(chan struct{}),
+		exited:      make(chan struct{}),
+		from:        make(chan *runtime.MemStats),
+		fromDone:    make(chan struct{}),
+		drains:      make(chan drainRequest),
+		keyRequests: make(chan chan map[string]bool),
+		longKeys:    make(map[string]string),
+		series:      make(map[string]struct{}),
+		lastSent:    make(map[string]*sentValue),
+	}
+	c.gaugeFunc = c.send
+	c.monotonic = monotonicNow
+	switch {
+	case s.keyTemplate != "":
+		c.keyHead, c.keyTail = templateParts(s.keyTemplate, prefix, s.templateValues)
+	case s.includeBinaryName && prefix != "":
+		c.keyHead = prefix + "." + binaryName() + "."
+	case s.includeBinaryName:
+		c.keyHead = binaryName() + "."
+	case prefix != "":
+		c.keyHead = prefix + "."
+	}
+	if s.historySize > 0 {
+		c.history = newHistory(s.historySize)
+	}
+	c.enableCPU.Store(true)
+	c.enableMem.Store(true)
+	c.enableGC.Store(true)
+	return c
+}
+
+// monotonicEpoch anchors the readings of monotonicNow.
+var monotonicEpoch = time.Now()
+
+// monotonicNow reads the monotonic clock, which wall clock jumps don't
+// affect.
+func monotonicNow() time.Duration {
+	return time.Since(monotonicEpoch)
+}
+
+// clone returns a new collector with the configuration of c, outputting to
+// sink under prefix. None of the running state of c is copied.
+func (c *collector) clone(prefix string, sink Sink) *collector {
+	col := newCollector(prefix, sink, c.settings)
+	// Copied as is, c warned about them already.
+	col.enableCPU.Store(c.enableCPU.Load())
+	col.enableMem.Store(c.enableMem.Load())
+	col.enableGC.Store(c.enableGC.Load())
+	col.memFloor.Store(c.memFloor.Load())
+	return col
+}
+
+func (c *collector) setEnabled(cpu bool, mem bool, gc bool) {
+	// The GC statistics are derived from the memory ones and can't be
+	// output without them.
+	if gc && !mem {
+		c.logger.Warn("GC statistics are enabled but need memory statistics, none will be output")
+	}
+	// The tickers of a running collector can't be changed, the memory
+	// passes coming too early are skipped instead.
+	if interval := *c.memIntervalRef(); mem && c.minMemInterval > 0 && interval < c.minMemInterval && c.memFloor.Load() == 0 {
+		c.logger.Warn("memory stats interval below the minimum, skipping passes", "interval", interval, "min", c.minMemInterval)
+		c.memFloor.Store(int64(c.minMemInterval))
+	}
+	c.enableCPU.Store(cpu)
+	c.enableMem.Store(mem)
+	c.enableGC.Store(gc)
+}
+
+// minMemInterval returns the MinMemInterval floor, zero when lifted.
+func minMemInterval() time.Duration {
+	if AllowFastInterval {
+		return 0
+	}
+	return MinMemInterval
+}
+
+// memIntervalRef returns the interval memory statistics are read on.
+func (c *collector) memIntervalRef() *time.Duration {
+	if c.memInterval > 0 {
+		return &c.memInterval
+	}
+	return &c.pauseDur
+}
+
+// floorMemInterval clamps the intervals memory statistics are read on up to
+// minMemInterval, before the collector starts.
+func (c *collector) floorMemInterval() {
+	if interval := c.memIntervalRef(); *interval < c.minMemInterval {
+		c.logger.Warn("memory stats interval below the minimum, clamping", "interval", *interval, "min", c.minMemInterval)
+		*interval = c.minMemInterval
 	}
 }
 
-// Run gathers statistics from package runtime and outputs them statsd,
-// this will never return.
-func (c *collector) run() {
-	c.outputStats()
+// floored leaves the memory section out of sections when memFloor hasn't
+// passed since the previous memory pass.
+func (c *collector) floored(sections section) section {
+	if floor := time.Duration(c.memFloor.Load()); floor > 0 && c.prevMem != nil && c.monotonic()-c.prevMemAt < floor {
+		return sections &^ sectionMem
+	}
+	return sections
+}
+
+// run collects until stopped, returning nil, ctx is done, returning its
+// error, or the collector gives up on the sink, returning the fatal error.
+func (c *collector) run(ctx context.Context) error {
+	defer close(c.exited)
+	defer c.osMem.close()
+	defer c.cgroupCPU.close()
+	defer c.closeSink()
+
+	for {
+		err := c.loop(ctx)
+		if err == nil || ctx.Err() != nil || c.restartBackoff <= 0 {
+			return err
+		}
+
+		c.diag.restarts.Add(1)
+		c.logger.Warn("collection stopped unexpectedly, restarting", "error", err, "backoff", c.restartBackoff)
+		timer := time.NewTimer(c.restartBackoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			c.shutdown()
+			return ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			c.shutdown()
+			return nil
+		}
+		c.fatal = nil
+		c.trips = 0
+	}
+}
+
+// loop collects on every tick until stopped, returning like run, or with
+// the error of a panic when restarting after RestartBackoff.
+func (c *collector) loop(ctx context.Context) (err error) {
+	if c.restartBackoff > 0 {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logger.Error("collection goroutine panicked", "panic", r, "stack", string(debug.Stack()))
+				c.pass = nil
+				c.ordered = c.ordered[:0]
+				err = fmt.Errorf("collection panicked: %v", r)
+			}
+		}()
+	}
+
+	if c.emitOnStart {
+		c.collect(allSections, nil)
+	}
 
 	// Gauges are a 'snapshot' rather than a histogram. Pausing for some interval
 	// aims to get a 'recent' snapshot out before statsd flushes metrics.
 	tick := time.NewTicker(c.pauseDur)
 	defer tick.Stop()
+
+	// Sections on an interval of their own are left out of the main one.
+	main := allSections
+	cpuTick := c.sectionTicker(c.cpuInterval, sectionCPU, &main)
+	memTick := c.sectionTicker(c.memInterval, sectionMem, &main)
+	defer cpuTick.stop()
+	defer memTick.stop()
+
+	trigger := c.trigger
+
+	var sample <-chan time.Time
+	cpuDur := c.pauseDur
+	if c.cpuInterval > 0 {
+		cpuDur = c.cpuInterval
+	}
+	if c.goroutineSamples > 1 && cpuDur/time.Duration(c.goroutineSamples) > 0 {
+		sampleTick := time.NewTicker(cpuDur / time.Duration(c.goroutineSamples))
+		defer sampleTick.Stop()
+		sample = sampleTick.C
+	}
+
 	for {
+		if c.fatal != nil {
+			c.logger.Error("giving up on failing sink", "error", c.fatal)
+			return c.fatal
+		}
 		select {
 		case <-tick.C:
-			c.outputStats()
+			c.collect(c.floored(main), nil)
+		case <-cpuTick.c:
+			c.collect(sectionCPU, nil)
+		case <-memTick.c:
+			c.collect(c.floored(sectionMem), nil)
+		case <-sample:
+			if !c.paused.Load() {
+				c.sampleGoroutines()
+			}
+		case _, ok := <-trigger:
+			if !ok {
+				trigger = nil
+				continue
+			}
+			c.collect(allSections, nil)
+		case m := <-c.from:
+			c.collectFrom(m)
+		case req := <-c.drains:
+			req.reply <- c.drain(req.ctx)
+		case reply := <-c.keyRequests:
+			c.replyKeys(reply)
+		case <-ctx.Done():
+			c.shutdown()
+			return ctx.Err()
+		case <-c.done:
+			c.shutdown()
+			return nil
+		}
+	}
+}
+
+// collectFrom makes the pass of OutputFrom, acknowledging it even when the
+// pass panics and loop recovers, so OutputFrom doesn't wait forever.
+func (c *collector) collectFrom(m *runtime.MemStats) {
+	defer func() { c.fromDone <- struct{}{} }()
+	c.collect(allSections, m)
+}
+
+// replyKeys answers a request of SupportedMetrics, with no keys when the
+// pass panics.
+func (c *collector) replyKeys(reply chan map[string]bool) {
+	var keys map[string]bool
+	defer func() { reply <- keys }()
+	keys = c.supportedKeys()
+}
+
+// closeSink closes the sink if it is an io.Closer, waiting for the sends it
+// has in flight to complete, so Stop returns once the final output is
+// actually out. The wait is bounded by shutdownTimeout, a sink still sending
+// after it is left to finish in the background.
+func (c *collector) closeSink() {
+	cl, ok := c.sink.(io.Closer)
+	if !ok {
+		return
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- cl.Close() }()
+
+	timer := time.NewTimer(c.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-closed:
+		if err != nil {
+			c.logger.Error("error closing sink", "error", err)
 		}
+	case <-timer.C:
+		c.logger.Warn("sink close timed out, sends still in flight", "timeout", c.shutdownTimeout)
+	}
+}
+
+// shutdown makes the final output and drains the sink.
+func (c *collector) shutdown() {
+	c.zeroStats()
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	c.drain(ctx)
+	cancel()
+}
+
+// stop makes run return after the final flush and waits for it to exit.
+func (c *collector) stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+	<-c.exited
+}
+
+// zeroStats makes the final output of every gauge sent so far according to
+// the shutdown mode, giving up once shutdownTimeout has passed.
+func (c *collector) zeroStats() {
+	if c.shutdownMode == ShutdownNone {
+		return
+	}
+
+	c.passTime = time.Now()
+	deadline := c.passTime.Add(c.shutdownTimeout)
+	if d, ok := c.sink.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		d.SetWriteDeadline(deadline)
+	}
+	if fs, ok := c.sink.(fullRateSink); ok {
+		fs.SetFullRate(true)
+		defer fs.SetFullRate(false)
+	}
+	defer c.flush()
+	if c.stableOrder {
+		slices.Sort(c.keys)
+	}
+	ks, _ := c.sink.(kindSink)
+	for i, key := range c.keys {
+		if ks != nil && ks.Typed(key) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			c.logger.Warn("shutdown flush timed out", "dropped_count", len(c.keys)-i)
+			return
+		}
+		var value uint64
+		if c.shutdownMode == ShutdownSticky {
+			value = c.lastValue[key]
+		}
+		if err := c.gauge(key, value); err != nil {
+			c.logger.Warn("shutdown flush failed", "dropped_count", len(c.keys)-i, "error", err)
+			return
+		}
+	}
+}
+
+// probe receives the allocation made by checkMemStats, so it can't be
+// optimized away.
+var probe []byte
+
+// checkMemStats verifies runtime.ReadMemStats reflects an allocation, some
+// sandboxed or instrumented runtimes return stale values.
+func (c *collector) checkMemStats() {
+	c.memStatsChecked = true
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	probe = make([]byte, 1024)
+	runtime.ReadMemStats(&after)
+
+	if after.Mallocs > before.Mallocs && after.TotalAlloc > before.TotalAlloc {
+		c.memStatsHealthy = 1
+		return
+	}
+	c.memStatsHealthy = 0
+	c.logger.Warn("runtime.ReadMemStats doesn't reflect allocations, memory statistics can't be trusted")
+}
+
+// section is a set of statistics output together.
+type section uint
+
+const (
+	sectionCPU section = 1 << iota
+	sectionMem
+	sectionOther
+
+	allSections = sectionCPU | sectionMem | sectionOther
+)
+
+// sectionTick is the ticker of a section with an interval of its own, its
+// channel is nil if the section has none.
+type sectionTick struct {
+	t *time.Ticker
+	c <-chan time.Time
+}
+
+func (t sectionTick) stop() {
+	if t.t != nil {
+		t.t.Stop()
+	}
+}
+
+// sectionTicker starts a ticker for s if interval is positive, removing s
+// from the main sections.
+func (c *collector) sectionTicker(interval time.Duration, s section, main *section) sectionTick {
+	if interval <= 0 {
+		return sectionTick{}
+	}
+	*main &^= s
+	t := time.NewTicker(interval)
+	return sectionTick{t: t, c: t.C}
+}
+
+// collect runs a single collection pass of the given sections, recovering
+// from any panic if configured to.
+func (c *collector) collect(sections section, from *runtime.MemStats) {
+	if c.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logger.Error("collection pass panicked", "panic", r, "stack", string(debug.Stack()))
+				c.pass = nil
+				c.ordered = c.ordered[:0]
+			}
+		}()
+	}
+	if c.paused.Load() {
+		return
+	}
+	if c.diag.breakerOpen.Load() && time.Now().Before(c.breakerUntil) {
+		return
+	}
+	c.outputStats(sections, from)
+	if c.diag.breakerOpen.Load() && c.failures == 0 {
+		c.trips = 0
+		c.diag.breakerOpen.Store(false)
+		c.logger.Info("sink recovered, resuming collection")
+	}
+}
+
+// CPUStats are the goroutine and cgo statistics the CPU metrics are output
+// from.
+type CPUStats struct {
+	NumGoroutine    uint64
+	NumGoroutineMax uint64
+	NumCgoCall      uint64
+}
+
+// sampleGoroutines records the current goroutine count towards the maximum
+// reported on the next output.
+func (c *collector) sampleGoroutines() uint64 {
+	n := uint64(runtime.NumGoroutine())
+	if n > c.goroutineMax {
+		c.goroutineMax = n
+	}
+	return n
+}
+
+// outputStats outputs a pass of the given sections, using the memory
+// statistics in from rather than reading them if it isn't nil.
+func (c *collector) outputStats(sections section, from *runtime.MemStats) {
+	c.passTime = time.Now()
+	c.passKeys = 0
+	startAllocs := c.heapAllocs()
+	if c.emitSequence {
+		c.seq++
+		c.send("cpu.CollectSeq", c.seq)
+	}
+	if sections&sectionCPU != 0 && c.enableCPU.Load() {
+		cStats := &c.cpuBufs[0]
+		if cStats == c.prevCPU {
+			cStats = &c.cpuBufs[1]
+		}
+		if c.cpuFrom != nil {
+			*cStats = *c.cpuFrom
+		} else {
+			*cStats = CPUStats{
+				NumGoroutine:    c.sampleGoroutines(),
+				NumGoroutineMax: c.goroutineMax,
+				NumCgoCall:      uint64(runtime.NumCgoCall()),
+			}
+		}
+		c.goroutineMax = 0
+		c.warming = c.cpuPasses < c.warmupIntervals
+		c.cpuPasses++
+		c.outputCPUStats(cStats)
+		c.prevCPU = cStats
+		if c.enableSchedLatency || c.schedStats {
+			c.outputSchedLatency()
+		}
+		if c.enableGoroutinesCreated {
+			c.outputGoroutinesCreated()
+		}
+		if c.enableBlockProfile {
+			c.outputBlockProfile()
+		}
+		if c.enableMutexProfile {
+			c.outputMutexProfile()
+		}
+	}
+	if sections&sectionMem != 0 && c.enableMem.Load() {
+		m := &c.memBufs[0]
+		if m == c.prevMem {
+			m = &c.memBufs[1]
+		}
+		if from != nil {
+			*m = *from
+		} else {
+			// Checked on the first memory pass rather than on start, so
+			// collectors without memory statistics don't pay for it.
+			if !c.memStatsChecked {
+				c.checkMemStats()
+			}
+			runtime.ReadMemStats(m)
+		}
+		if c.memStatsChecked {
+			c.send("cpu.MemStatsHealthy", c.memStatsHealthy)
+		}
+		if c.schedStats && c.gcMetrics&GCCPUFraction != 0 {
+			c.send("cpu.GCCPUFraction", floatToUint(m.GCCPUFraction*1e6))
+		}
+
+		// Measured on the monotonic clock, keeping the rate
+		// denominators immune to wall clock jumps.
+		now := c.monotonic()
+		if c.prevMem != nil {
+			c.memElapsed = now - c.prevMemAt
+		}
+		c.warming = c.memPasses < c.warmupIntervals
+		c.memPasses++
+		c.outputMemStats(m)
+		if c.rawMemStats != nil {
+			c.writeRawMemStats(m)
+		}
+		if c.bySize {
+			c.outputBySize(m)
+		}
+		if c.enableOSMem {
+			c.outputOSMemStats()
+		}
+		if c.enableGC.Load() {
+			c.outputGCStats(m)
+			if c.enableGCCPU {
+				c.outputGCCPUStats()
+			}
+			c.outputFinalizerStats()
+		}
+		c.prevMem = m
+		c.prevMemAt = now
+	}
+	if sections&sectionOther != 0 {
+		c.warming = false
+		if c.enableAllRuntimeMetrics {
+			c.outputRuntimeMetrics()
+		}
+		if len(c.histogramSelection) > 0 {
+			c.outputHistogramBuckets()
+		}
+		c.outputUserMetrics()
+	}
+	c.endPass()
+	if c.countedSections != allSections {
+		// Sections on intervals of their own are first output by
+		// separate passes, added up until each has been.
+		c.countedSections |= sections
+		c.countedKeys += c.passKeys
+		if c.countedSections == allSections {
+			c.metricsAvailable = c.countedKeys
+		}
+	}
+	if d, ok := c.sink.(durationSink); ok {
+		d.CollectDuration(time.Since(c.passTime))
 	}
+	c.flush()
+	c.passAllocs = sub(c.heapAllocs(), startAllocs)
+	c.diag.passes.Add(1)
+	c.diag.lastPassTime.Store(int64(time.Since(c.passTime)))
 }
 
-type cpuStats struct {
-	NumGoroutine uint64
-	NumCgoCall   uint64
+// heapAllocs returns the cumulative bytes allocated on the heap, read from
+// runtime/metrics as it doesn't stop the world like ReadMemStats.
+func (c *collector) heapAllocs() uint64 {
+	n, _ := c.readRuntimeMetric("/gc/heap/allocs:bytes")
+	return n
 }
 
-func (c *collector) outputStats() {
-	if c.enableCPU {
-		cStats := cpuStats{
-			NumGoroutine: uint64(runtime.NumGoroutine()),
-			NumCgoCall:   uint64(runtime.NumCgoCall()),
+// readRuntimeMetric reads a single uint64 runtime/metrics value, reporting
+// false if the running Go version doesn't support it.
+func (c *collector) readRuntimeMetric(name string) (uint64, bool) {
+	c.sample[0].Name = name
+	metrics.Read(c.sample[:])
+	if c.sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0, false
+	}
+	return c.sample[0].Value.Uint64(), true
+}
+
+func (c *collector) outputCPUStats(s *CPUStats) {
+	if c.cpuFrom == nil {
+		checkGoroutineThresholds(int(s.NumGoroutine))
+	}
+	c.send("cpu.NumGoroutine", s.NumGoroutine)
+	maxGoroutines := s.NumGoroutineMax
+	if ws, ok := c.sink.(windowSink); ok {
+		if tracked, start := ws.goroutineWindow(); tracked {
+			if start {
+				c.windowMin, c.windowMax = s.NumGoroutine, 0
+			}
+			c.windowMin = min(c.windowMin, s.NumGoroutine)
+			c.windowMax = max(c.windowMax, s.NumGoroutineMax)
+			c.send("cpu.NumGoroutineMin", c.windowMin)
+			maxGoroutines = c.windowMax
 		}
-		c.outputCPUStats(&cStats)
 	}
-	if c.enableMem {
-		m := &runtime.MemStats{}
-		runtime.ReadMemStats(m)
-		c.outputMemStats(m)
-		if c.enableGC {
-			c.outputGCStats(m)
+	c.send("cpu.NumGoroutineMax", maxGoroutines)
+	prev := s
+	if c.prevCPU != nil {
+		prev = c.prevCPU
+	}
+	c.sendCounter("cpu.NumCgoCall", s.NumCgoCall, prev.NumCgoCall)
+	// The interval of the CPU passes, this being one of them.
+	interval := c.pauseDur
+	if c.cpuInterval > 0 {
+		interval = c.cpuInterval
+	}
+	c.send("cpu.CollectIntervalMs", uint64(interval.Milliseconds()))
+
+	// Parallelism configured against the CPUs available, a mismatch is
+	// common in containers with a CPU quota.
+	procs := uint64(runtime.GOMAXPROCS(0))
+	cpus := uint64(runtime.NumCPU())
+	if c.schedStats {
+		c.send("cpu.GOMAXPROCS", procs)
+	}
+	c.send("cpu.NumCPU", cpus)
+	c.send("cpu.ProcsCPURatioPPM", ppm(procs, cpus))
+	c.outputCGroupQuota()
+	c.send("cpu.MetricsAvailable", c.metricsAvailable)
+	c.outputClock()
+	// Bytes allocated by every goroutine while the previous pass ran, an
+	// upper bound of what the collector itself allocates.
+	c.send("cpu.CollectorAllocBytes", c.passAllocs)
+	if c.emitCollectDuration {
+		c.send("cpu.CollectDurationNs", uint64(c.diag.lastPassTime.Load()))
+	}
+	if d, ok := c.sink.(droppingSink); ok {
+		c.send("cpu.SinkDropped", d.Dropped())
+	}
+	if q, ok := c.sink.(queueingSink); ok {
+		c.send("cpu.SinkQueued", q.Queued())
+	}
+	if c.breakerFailures > 0 {
+		c.send("cpu.BreakerTrips", c.diag.breakerTrips.Load())
+	}
+	if c.restartBackoff > 0 {
+		c.send("cpu.CollectorRestarts", c.diag.restarts.Load())
+	}
+	if c.maxSeries > 0 {
+		var exceeded uint64
+		if c.seriesExceeded {
+			exceeded = 1
 		}
+		c.send(seriesBudgetBucket, exceeded)
 	}
 }
 
-func (c *collector) outputCPUStats(s *cpuStats) {
-	c.send("cpu.NumGoroutine", s.NumGoroutine)
-	c.send("cpu.NumCgoCall", s.NumCgoCall)
+// outputClock outputs the wall clock and its drift from the reference.
+func (c *collector) outputClock() {
+	if c.emitClock {
+		c.send("cpu.WallClockUnixMs", uint64(c.passTime.UnixMilli()))
+	}
+	if c.clockReference == nil {
+		return
+	}
+
+	ref, err := c.clockReference()
+	if err != nil {
+		c.logger.Warn("error reading reference clock", "error", err)
+		return
+	}
+	// Round(0) strips the monotonic reading, comparing wall clocks only.
+	drift := time.Now().Round(0).Sub(ref.Round(0))
+	var ahead uint64
+	if drift > 0 {
+		ahead = 1
+	} else {
+		drift = -drift
+	}
+	c.send("cpu.ClockDriftMs", uint64(drift.Milliseconds()))
+	c.send("cpu.ClockAhead", ahead)
 }
 
 func (c *collector) outputMemStats(m *runtime.MemStats) {
+	prev := c.previous(m)
+
 	// sys
 	c.send("mem.sys.Sys", m.Sys)
-	c.send("mem.sys.Lookups", m.Lookups)
+	c.sendCounter("mem.sys.Lookups", m.Lookups, prev.Lookups)
 	c.send("mem.sys.OtherSys", m.OtherSys)
+	c.send("mem.sys.BuckHashSys", m.BuckHashSys)
 
 	// common
 	c.send("mem.com.Total_VM_Bytes_Reserved", m.Sys)
 	c.send("mem.com.Live_Heap_Bytes_Allocated", m.Alloc)
-	c.send("mem.com.Cumulative_Heap_Bytes_Allocated", m.TotalAlloc)
+	c.sendCounter("mem.com.Cumulative_Heap_Bytes_Allocated", m.TotalAlloc, prev.TotalAlloc)
 	c.send("mem.com.Total_Stack_Allocation", m.StackSys)
 	c.send("mem.com.Other_Bytes_Allocation", m.OtherSys)
+	c.send("mem.com.TotalRuntimeBytes", m.HeapSys+m.StackSys+m.MSpanSys+m.MCacheSys+m.GCSys)
+	// Estimate of the resident runtime memory, to compare against container
+	// limits: what was obtained from the OS less what was returned to it.
+	c.send("mem.com.EstimatedRSSBytes", sub(m.Sys, m.HeapReleased))
+	// Bytes allocated per second over the interval, zero on the first pass.
+	c.sendDelta("mem.com.AllocRate", c.perSecond(sub(m.TotalAlloc, prev.TotalAlloc)))
 
 	// Heap
 	c.send("mem.heap.Alloc", m.Alloc)
-	c.send("mem.heap.TotalAlloc", m.TotalAlloc)
-	c.send("mem.heap.Mallocs", m.Mallocs)
-	c.send("mem.heap.Frees", m.Frees)
+	c.sendCounter("mem.heap.TotalAlloc", m.TotalAlloc, prev.TotalAlloc)
+	c.sendCounter("mem.heap.Mallocs", m.Mallocs, prev.Mallocs)
+	c.sendCounter("mem.heap.Frees", m.Frees, prev.Frees)
 	c.send("mem.heap.HeapAlloc", m.HeapAlloc)
 	c.send("mem.heap.HeapSys", m.HeapSys)
 	c.send("mem.heap.HeapIdle", m.HeapIdle)
 	c.send("mem.heap.HeapInuse", m.HeapInuse)
 	c.send("mem.heap.HeapReleased", m.HeapReleased)
 	c.send("mem.heap.HeapObjects", m.HeapObjects)
+	// Live object growth since the previous pass, a leak of many small
+	// objects shows here before it does in bytes. Zero when shrinking.
+	c.sendDelta("mem.heap.HeapObjectsDelta", sub(m.HeapObjects, prev.HeapObjects))
+	c.sendDelta("mem.heap.MallocRate", c.perSecond(sub(m.Mallocs, prev.Mallocs)))
+	c.sendDelta("mem.heap.FreeRate", c.perSecond(sub(m.Frees, prev.Frees)))
+	// The same allocations as counts, whatever DeltaMode. Zero on the first
+	// pass.
+	c.sendDelta("mem.heap.MallocsPerInterval", sub(m.Mallocs, prev.Mallocs))
+	c.sendDelta("mem.heap.FreesPerInterval", sub(m.Frees, prev.Frees))
+	// How much of the heap reserved from the OS is in use; close to the
+	// million the runtime is about to reserve more, ahead of any RSS jump.
+	c.send("mem.heap.UtilizationPPM", ppm(m.HeapInuse, m.HeapSys))
+
+	// Average size of the live heap objects, a shift of which points to the
+	// kind of allocations dominating.
+	var avgObject uint64
+	if m.HeapObjects > 0 {
+		avgObject = m.HeapAlloc / m.HeapObjects
+	}
+	c.send("mem.heap.AvgObjectSizeBytes", avgObject)
+
+	// How many times the live heap's worth has been allocated over the life
+	// of the process, rising quickly under churn the GC keeps up with.
+	c.send("mem.heap.TurnoverRatioPPM", ppm(m.TotalAlloc, m.HeapAlloc))
+
+	// Idle heap kept from the OS, what debug.FreeOSMemory would reclaim.
+	c.send("mem.heap.RetainedIdle", sub(m.HeapIdle, m.HeapReleased))
+
+	// Share of the idle heap released to the OS, averaged over the passes
+	// since start that found any idle heap. Persistently low, the scavenger
+	// is holding on to memory.
+	if m.HeapIdle > 0 {
+		c.releasePPMSum += ppm(m.HeapReleased, m.HeapIdle)
+		c.releasePasses++
+	}
+	if c.releasePasses > 0 {
+		c.send("mem.heap.ReleaseEfficiencyPPM", c.releasePPMSum/c.releasePasses)
+	}
+
+	// Growth of the heap reserved from the OS, which rarely shrinks; a
+	// persistently positive delta is a heap ratcheting up.
+	c.sendDelta("mem.heap.HeapSysDelta", sub(m.HeapSys, prev.HeapSys))
+
+	// Memory returned to the OS over the interval, split between forced
+	// releases, as by debug.FreeOSMemory, and the background scavenger. The
+	// split is a heuristic: everything released during an interval with a
+	// forced GC is attributed to it, though the scavenger may have
+	// contributed.
+	forced, background := uint64(0), sub(m.HeapReleased, prev.HeapReleased)
+	if m.NumForcedGC != prev.NumForcedGC {
+		forced, background = background, 0
+	}
+	c.sendDelta("mem.heap.ForcedReleaseBytes", forced)
+	c.sendDelta("mem.heap.BackgroundReleaseBytes", background)
 
 	// Stack
 	c.send("mem.stack.StackSys", m.StackSys)
@@ -126,40 +1538,817 @@ func (c *collector) outputMemStats(m *runtime.MemStats) {
 	c.send("mem.stack.MSpanSys", m.MSpanSys)
 	c.send("mem.stack.MCacheInuse", m.MCacheInuse)
 	c.send("mem.stack.MCacheSys", m.MCacheSys)
+	c.send("mem.stack.MSpanSlack", sub(m.MSpanSys, m.MSpanInuse))
+	c.send("mem.stack.MCacheSlack", sub(m.MCacheSys, m.MCacheInuse))
+
+	// Runtime metadata growth since the previous pass, steady growth hints
+	// at span and cache fragmentation. Zero when shrinking.
+	c.sendDelta("mem.stack.MSpanInuseDelta", sub(m.MSpanInuse, prev.MSpanInuse))
+	c.sendDelta("mem.stack.MCacheInuseDelta", sub(m.MCacheInuse, prev.MCacheInuse))
 
 }
 
 func (c *collector) outputGCStats(m *runtime.MemStats) {
-	c.send("mem.gc.GCSys", m.GCSys)
-	c.send("mem.gc.NextGC", m.NextGC)
-	c.send("mem.gc.LastGC", m.LastGC)
-	c.send("mem.gc.PauseTotalNs", m.PauseTotalNs)
-	c.send("mem.gc.Pause", m.PauseNs[(m.NumGC+255)%256])
-	c.send("mem.gc.NumGC", uint64(m.NumGC))
+	prev := c.previous(m)
+
+	if c.gcMetrics&GCSys != 0 {
+		c.send("mem.gc.GCSys", m.GCSys)
+	}
+	if c.gcMetrics&GCNextGC != 0 {
+		c.send("mem.gc.NextGC", m.NextGC)
+	}
+	if c.gcMetrics&GCLastGC != 0 {
+		c.send("mem.gc.LastGC", m.LastGC)
+	}
+	if c.gcMetrics&GCPauseTotalNs != 0 {
+		c.sendCounter("mem.gc.PauseTotalNs", m.PauseTotalNs, prev.PauseTotalNs)
+	}
+	if c.gcMetrics&GCPause != 0 {
+		c.send("mem.gc.Pause", m.PauseNs[(m.NumGC+255)%256])
+		c.outputPausePercentiles(m, prev)
+	}
+	if c.gcMetrics&GCNumGC != 0 {
+		c.sendCounter("mem.gc.NumGC", uint64(m.NumGC), uint64(prev.NumGC))
+		// Zero on the first pass.
+		c.sendDelta("mem.gc.NumGCPerInterval", uint64(m.NumGC-prev.NumGC))
+	}
+
+	// Collections and pause time this interval, as counters so an
+	// aggregating server can compute the average pause itself.
+	if c.gcMetrics&GCNumGC != 0 {
+		c.count("mem.gc.PauseCount", uint64(m.NumGC-prev.NumGC))
+	}
+	if c.gcMetrics&GCPauseTotalNs != 0 {
+		c.count("mem.gc.PauseSumNs", sub(m.PauseTotalNs, prev.PauseTotalNs))
+
+		// The same pause time as a gauge, for correlating with latency
+		// spikes on backends that don't sum counters. Zero on the first
+		// pass.
+		c.send("mem.gc.PauseIntervalTotalNs", sub(m.PauseTotalNs, prev.PauseTotalNs))
+	}
+
+	if c.gcMetrics&GCNextGC != 0 {
+		// Expected heap growth before the next collection.
+		c.send("mem.gc.NextGCRatioPPM", ppm(m.NextGC, m.HeapAlloc))
+
+		// Direction of the heap goal since the previous pass: 1 up, 0 flat
+		// and 2 down, gauges being unsigned.
+		var trend uint64
+		switch {
+		case m.NextGC > prev.NextGC:
+			trend = 1
+		case m.NextGC < prev.NextGC:
+			trend = 2
+		}
+		c.sendDelta("mem.gc.NextGCTrend", trend)
+
+		// How far the heap has grown into the current GC cycle.
+		c.send("mem.gc.CycleProgressPPM", ppm(m.HeapAlloc, m.NextGC))
+	}
+
+	// Bytes allocated into the current cycle, from the heap seen by the
+	// first pass after a GC, taken as the post-GC baseline. Passes only
+	// see the heap at their own time, so allocations between the GC and
+	// that pass are missed.
+	if m == prev || m.NumGC != prev.NumGC {
+		c.postGCHeapAlloc = m.HeapAlloc
+	}
+	if c.gcMetrics&GCNumGC != 0 {
+		c.send("mem.gc.HeapGrowthSinceGCBytes", sub(m.HeapAlloc, c.postGCHeapAlloc))
+
+		// Bytes allocated per collection this interval, zero without any.
+		var perCycle uint64
+		if cycles := uint64(m.NumGC - prev.NumGC); cycles > 0 {
+			perCycle = sub(m.TotalAlloc, prev.TotalAlloc) / cycles
+		}
+		c.sendDelta("mem.gc.AllocPerCycleBytes", perCycle)
+	}
+
+	// Latest pause against the average one, far above a million for an
+	// outlier. Zero before the first collection.
+	if c.gcMetrics&GCPause != 0 {
+		var avgPause uint64
+		if m.NumGC > 0 {
+			avgPause = m.PauseTotalNs / uint64(m.NumGC)
+		}
+		c.send("mem.gc.LastPauseVsAvgPPM", ppm(m.PauseNs[(m.NumGC+255)%256], avgPause))
+	}
+
+	// Whether the GC is turned off, by GOGC=off or debug.SetGCPercent(-1),
+	// leaving the heap to grow unbounded short of a memory limit. The
+	// setting is read from runtime/metrics, where off shows as -1, rather
+	// than through SetGCPercent so the check doesn't change it even
+	// briefly.
+	if gogc, ok := c.readRuntimeMetric("/gc/gogc:percent"); ok {
+		var disabled uint64
+		if int64(gogc) < 0 {
+			disabled = 1
+		}
+		c.send("mem.gc.Disabled", disabled)
+	}
+
+	// Heap goal and live heap as the GC itself tracks them, the goal falling
+	// back on NextGC where runtime/metrics lacks it. The live heap has no
+	// MemStats equivalent and is left out before Go 1.21.
+	if c.gcMetrics&GCGoal != 0 {
+		goal, ok := c.readRuntimeMetric("/gc/heap/goal:bytes")
+		if !ok {
+			goal = m.NextGC
+		}
+		c.send("mem.gc.Goal", goal)
+	}
+	if c.gcMetrics&GCLive != 0 {
+		if live, ok := c.readRuntimeMetric("/gc/heap/live:bytes"); ok {
+			c.send("mem.gc.Live", live)
+		}
+	}
+
+	// Heap goal against the soft memory limit, when one is set. A goal
+	// close to the limit makes the GC run constantly.
+	if limit := debug.SetMemoryLimit(-1); c.gcMetrics&GCGoal != 0 && limit > 0 && limit < math.MaxInt64 {
+		c.send("mem.gc.GoalVsLimitPPM", ppm(m.NextGC, uint64(limit)))
+	}
+
+	c.outputGCPressure(m, prev)
+	c.outputMemPressure(m, prev)
+}
+
+// outputPausePercentiles outputs the percentiles and the maximum of the GC
+// pauses since the previous pass, on passes following any. Only the latest
+// 256 are kept by the runtime, so a busier interval is summarized from
+// those.
+func (c *collector) outputPausePercentiles(m *runtime.MemStats, prev *runtime.MemStats) {
+	n := m.NumGC - prev.NumGC
+	if n == 0 {
+		return
+	}
+	ring := uint32(len(m.PauseNs))
+	n = min(n, ring)
+	c.pauses = c.pauses[:0]
+	for i := uint32(1); i <= n; i++ {
+		c.pauses = append(c.pauses, m.PauseNs[(m.NumGC-i)%ring])
+	}
+	slices.Sort(c.pauses)
+
+	// Nearest rank, the smallest pause at or above the percentile.
+	rank := func(p uint32) uint64 {
+		return c.pauses[(n*p+99)/100-1]
+	}
+	c.send("mem.gc.Pause.p50", rank(50))
+	c.send("mem.gc.Pause.p95", rank(95))
+	c.send("mem.gc.Pause.p99", rank(99))
+	c.send("mem.gc.Pause.max", c.pauses[n-1])
+}
+
+// outputMemPressure outputs mem.Pressure, as documented on
+// PressureThresholds.
+func (c *collector) outputMemPressure(m *runtime.MemStats, prev *runtime.MemStats) {
+	t := c.memPressure
+	var pressure uint64
+	if secs := c.memElapsed.Seconds(); secs > 0 {
+		if t.GCPerSecond > 0 && float64(m.NumGC-prev.NumGC)/secs > t.GCPerSecond {
+			pressure = 1
+		}
+		if t.PauseFraction > 0 && float64(sub(m.PauseTotalNs, prev.PauseTotalNs))/float64(c.memElapsed.Nanoseconds()) > t.PauseFraction {
+			pressure = 1
+		}
+	}
+	if limit := debug.SetMemoryLimit(-1); t.LimitHeadroom > 0 && limit > 0 && limit < math.MaxInt64 {
+		used := float64(sub(m.Sys, m.HeapReleased))
+		if 1-used/float64(limit) < t.LimitHeadroom {
+			pressure = 1
+		}
+	}
+	c.send("mem.Pressure", pressure)
+}
+
+// outputGCPressure outputs the composite GC pressure score and its
+// components, as documented on PressureWeights.
+func (c *collector) outputGCPressure(m *runtime.MemStats, prev *runtime.MemStats) {
+	w := c.gcPressure
+	var frequency, pause float64
+	if secs := c.memElapsed.Seconds(); secs > 0 {
+		if w.MaxGCPerSecond > 0 {
+			frequency = float64(m.NumGC-prev.NumGC) / secs / w.MaxGCPerSecond
+		}
+		if w.MaxPauseFraction > 0 {
+			pause = float64(sub(m.PauseTotalNs, prev.PauseTotalNs)) / float64(c.memElapsed.Nanoseconds()) / w.MaxPauseFraction
+		}
+	}
+	var headroom float64
+	if m.NextGC > 0 {
+		headroom = float64(m.HeapAlloc) / float64(m.NextGC)
+	}
+	frequency = math.Min(frequency, 1)
+	pause = math.Min(pause, 1)
+	headroom = math.Min(headroom, 1)
+
+	c.send("mem.gc.Pressure.Frequency", uint64(frequency*1000))
+	c.send("mem.gc.Pressure.Pause", uint64(pause*1000))
+	c.send("mem.gc.Pressure.Headroom", uint64(headroom*1000))
+
+	var score float64
+	if total := w.Frequency + w.PauseFraction + w.Headroom; total > 0 {
+		score = (w.Frequency*frequency + w.PauseFraction*pause + w.Headroom*headroom) / total
+	}
+	c.send("mem.gc.Pressure", uint64(score*1000))
+}
+
+// previous returns the memory statistics of the previous pass, or m itself on
+// the first pass so that deltas come out as zero.
+func (c *collector) previous(m *runtime.MemStats) *runtime.MemStats {
+	if c.prevMem == nil {
+		return m
+	}
+	return c.prevMem
+}
+
+// perSecond converts delta, accumulated since the previous memory statistics
+// were read, to a per second rate.
+func (c *collector) perSecond(delta uint64) uint64 {
+	if c.memElapsed <= 0 {
+		return 0
+	}
+	return floatToUint(float64(delta) / c.memElapsed.Seconds())
+}
+
+// ppm returns a / b in parts per million, zero if b is zero.
+func ppm(a uint64, b uint64) uint64 {
+	if b == 0 {
+		return 0
+	}
+	hi, lo := bits.Mul64(a, 1000000)
+	if hi >= b {
+		return math.MaxUint64
+	}
+	q, _ := bits.Div64(hi, lo, b)
+	return q
+}
+
+// sub returns a - b, clamped at zero.
+func sub(a uint64, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
 }
 
 func (c *collector) send(bucket string, value uint64) {
-	buf := []byte(fmt.Sprintf("%v.%v:%v|g", c.prefix, bucket, value))
-	n, err := c.conn.Write(buf)
+	if size := c.smooth[bucket]; size > 0 {
+		defer c.sendSmoothed(bucket, value, size)
+	}
+	key, value, keep := c.prepare(bucket, value)
+	if !keep {
+		return
+	}
+	c.lastValue[key] = value
+	c.record(key, value)
+	if !c.breached(key, value) || c.suppress(key, value) {
+		return
+	}
+	c.output(key, value, false)
+}
+
+// sendCounter outputs a monotonically increasing counter according to the
+// delta mode, cur being its current value and prev the previous pass one.
+func (c *collector) sendCounter(bucket string, cur uint64, prev uint64) {
+	c.sendCounterMode(bucket, cur, prev, c.deltaMode)
+}
+
+// sendCounterMode outputs a counter like sendCounter, according to mode
+// rather than the delta mode.
+func (c *collector) sendCounterMode(bucket string, cur uint64, prev uint64, mode CounterMode) {
+	if mode != DeltaOnly {
+		c.send(bucket, cur)
+	}
+	if mode != AbsoluteOnly && !c.warming {
+		name, ok := c.deltaNames[bucket]
+		if !ok {
+			if c.deltaNames == nil {
+				c.deltaNames = make(map[string]string)
+			}
+			name = bucket + ".delta"
+			c.deltaNames[bucket] = name
+		}
+		c.send(name, sub(cur, prev))
+	}
+}
+
+// sendDelta outputs a metric derived from the change since the previous
+// pass, unless warming up.
+func (c *collector) sendDelta(bucket string, value uint64) {
+	if !c.warming {
+		c.send(bucket, value)
+	}
+}
+
+// clamp caps value at maxValue.
+func (c *collector) clamp(key string, value uint64) uint64 {
+	if c.maxValue == 0 || value <= c.maxValue {
+		return value
+	}
+	c.logger.Warn("value capped", "key", key, "value", value, "max_value", c.maxValue)
+	return c.maxValue
+}
+
+// resolvedPrefix returns the prefix applied to keys, an empty prefix means
+// keys are sent without any leading segment.
+func (c *collector) resolvedPrefix() string {
+	return c.keyHead
+}
+
+// key composes the full key of bucket.
+func (c *collector) key(bucket string) string {
+	return c.keyHead + bucket + c.keyTail
+}
+
+// fullKey returns the full key of bucket, composing it only the first time.
+func (c *collector) fullKey(bucket string) string {
+	if key, ok := c.keyCache[bucket]; ok {
+		return key
+	}
+	name, renamed := schemeName(c.keyScheme, bucket)
+	if c.compactKeys && !renamed {
+		name = compactName(bucket)
+	}
+	key := c.key(name)
+	if c.sanitize != nil {
+		key = c.sanitize(key)
+	}
+	if us, ok := c.sink.(unitSink); ok {
+		if unit := metricUnit(bucket); unit != "" {
+			us.SetUnit(key, unit)
+		}
+	}
+	if ks, ok := c.sink.(kindSink); ok {
+		if kind := sentKind(bucket); kind != KindGauge {
+			ks.SetKind(key, kind)
+		}
+	}
+	c.keyCache[bucket] = key
+	return key
+}
+
+// prepare turns a bucket and its value into what gets sent: the full key is
+// composed from the prefix or template and sanitized, then passed to the
+// transform along with the value, and finally checked for length while the
+// value is capped. It reports false if the metric is left out of the golden
+// signals or the series budget, disabled, or dropped by the transform.
+func (c *collector) prepare(bucket string, value uint64) (string, uint64, bool) {
+	if c.goldenSignalsOnly && !goldenSignals[bucket] && metricUnit(bucket) != "" {
+		return "", 0, false
+	}
+	key := c.fullKey(bucket)
+	if c.transform != nil {
+		var keep bool
+		if key, value, keep = c.transform(key, value); !keep {
+			return "", 0, false
+		}
+	}
+	key = c.checkKey(key)
+	if !MetricEnabled(key) {
+		return "", 0, false
+	}
+	if bucket != seriesBudgetBucket && !c.admit(key) {
+		return "", 0, false
+	}
+	c.passKeys++
+	return key, c.clamp(key, value), true
+}
+
+// admit reports whether key fits in the series budget, adding it to the
+// admitted keys if it is new.
+func (c *collector) admit(key string) bool {
+	if c.maxSeries <= 0 {
+		return true
+	}
+	if _, ok := c.series[key]; ok {
+		return true
+	}
+	if len(c.series) >= c.maxSeries {
+		if !c.seriesExceeded {
+			c.seriesExceeded = true
+			c.logger.Warn("series budget exceeded, dropping new keys", "key", key, "max_series", c.maxSeries)
+		}
+		return false
+	}
+	c.series[key] = struct{}{}
+	return true
+}
+
+// count sends a counter increment. Counters aren't reset on shutdown.
+func (c *collector) count(bucket string, delta uint64) {
+	if c.warming {
+		return
+	}
+	key, delta, keep := c.prepare(bucket, delta)
+	if !keep {
+		return
+	}
+	c.record(key, delta)
+	c.output(key, delta, true)
+}
+
+// output hands a gauge or counter to the sink, or holds it until the end of
+// the pass if keys are sent in sorted order.
+func (c *collector) output(key string, value uint64, counter bool) {
+	if c.stableOrder {
+		c.ordered = append(c.ordered, pendingMetric{key, value, counter})
+		return
+	}
+	c.deliver(key, value, counter)
+}
+
+func (c *collector) deliver(key string, value uint64, counter bool) {
+	var err error
+	if cs, ok := c.sink.(CounterSink); ok && counter {
+		err = cs.Count(key, value)
+	} else {
+		err = c.gauge(key, value)
+	}
 	if err != nil {
-		fmt.Printf("error sending data:  %s", err)
-	} else if n != len(buf) {
-		fmt.Printf("error short send: %d < %d", n, len(buf))
+		c.sendFailed(key, err)
+		return
+	}
+	c.failures = 0
+	c.diag.emitted.Add(1)
+	// Gauges held back by the thresholds are left out of the shutdown
+	// flush, a zero would show as a breach of ThresholdsBelow.
+	if !counter && !c.delivered[key] {
+		c.delivered[key] = true
+		c.keys = append(c.keys, key)
+	}
+}
+
+// gauge hands a metric to the sink, along with the pass timestamp if the
+// sink records one.
+func (c *collector) gauge(key string, value uint64) error {
+	if ts, ok := c.sink.(TimestampedSink); ok {
+		return ts.GaugeAt(key, value, c.passTime)
+	}
+	return c.sink.Gauge(key, value)
+}
+
+// flush ends the current pass on the sink.
+func (c *collector) flush() {
+	if len(c.ordered) > 0 {
+		slices.SortFunc(c.ordered, func(a, b pendingMetric) int {
+			return strings.Compare(a.key, b.key)
+		})
+		for _, m := range c.ordered {
+			c.deliver(m.key, m.value, m.counter)
+		}
+		c.ordered = c.ordered[:0]
+	}
+	if err := c.sink.Flush(); err != nil {
+		c.logger.Error("error flushing data", "error", err)
+		c.setLastError(err)
+	}
+}
+
+// breached reports whether value crosses a threshold of key, or whether key
+// has none.
+func (c *collector) breached(key string, value uint64) bool {
+	above, hasAbove := c.thresholdsAbove[key]
+	below, hasBelow := c.thresholdsBelow[key]
+	if !hasAbove && !hasBelow {
+		return true
+	}
+	return hasAbove && value > above || hasBelow && value < below
+}
+
+// suppress reports whether sending value for key can be skipped because it
+// is unchanged, recording value as sent otherwise.
+func (c *collector) suppress(key string, value uint64) bool {
+	if !c.suppressUnchanged {
+		return false
+	}
+
+	last, ok := c.lastSent[key]
+	if !ok {
+		c.lastSent[key] = &sentValue{value: value}
+		return false
+	}
+	if last.value == value && (c.maxSuppressed <= 0 || last.skipped < c.maxSuppressed) {
+		last.skipped++
+		return true
+	}
+	last.value = value
+	last.skipped = 0
+	return false
+}
+
+// checkKey enforces the maximum key length, some statsd servers silently drop
+// metrics with over-long names.
+func (c *collector) checkKey(key string) string {
+	if c.maxKeyLen <= 0 || len(key) <= c.maxKeyLen {
+		return key
+	}
+	// Keys are checked after the transform, on every pass.
+	if checked, ok := c.longKeys[key]; ok {
+		return checked
+	}
+	c.logger.Warn("metric key too long", "key", key, "max_len", c.maxKeyLen)
+	checked := c.shortenKey(key)
+	c.longKeys[key] = checked
+	return checked
+}
+
+// shortenKey fits an over-long key to the maximum length following the
+// long key policy.
+func (c *collector) shortenKey(key string) string {
+	switch c.longKeyPolicy {
+	case LongKeyTruncate:
+		return key[:c.maxKeyLen]
+	case LongKeyHash:
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		sum := fmt.Sprintf("%08x", h.Sum32())
+		if c.maxKeyLen <= len(sum) {
+			return key[:c.maxKeyLen]
+		}
+		return key[:c.maxKeyLen-len(sum)] + sum
+	}
+	return key
+}
+
+// ResolvedPrefix returns the exact prefix, including the trailing separator,
+// applied to the keys of the running collector, or an empty string if
+// Collect hasn't been called.
+func ResolvedPrefix() string {
+	if c == nil {
+		return ""
+	}
+	return c.resolvedPrefix()
+}
+
+// SupportedMetrics returns the sorted keys the running collector outputs,
+// given its configuration and the running Go version, or those a collector
+// started now with every statistic enabled would output if none is running.
+// It makes a collection pass into a throwaway sink to find out, reading the
+// memory statistics once, on the collection goroutine of the running
+// collector so the registered sources and gauges aren't called concurrently.
+// Keys dropped by Transform or the series budget aren't included.
+func SupportedMetrics() []string {
+	var supported map[string]bool
+	if col := c; col != nil {
+		reply := make(chan map[string]bool, 1)
+		select {
+		case col.keyRequests <- reply:
+			supported = <-reply
+		case <-col.exited:
+			supported = col.supportedKeys()
+		}
+	} else {
+		supported = newCollector("", nil, packageSettings()).supportedKeys()
+	}
+
+	keys := make([]string, 0, len(supported))
+	for key := range supported {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// supportedKeys returns the keys a pass of c outputs, found by making one
+// with a clone of c into a keySink.
+func (c *collector) supportedKeys() map[string]bool {
+	ks := &keySink{keys: make(map[string]bool)}
+	col := c.clone(c.prefix, ks)
+	col.rawMemStats = nil
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.collect(allSections, nil)
+	return ks.keys
+}
+
+// keySink records the keys sent to it.
+type keySink struct {
+	keys map[string]bool
+}
+
+func (s *keySink) Gauge(key string, value uint64) error {
+	s.keys[key] = true
+	return nil
+}
+
+func (s *keySink) Flush() error {
+	return nil
+}
+
+// SetEnabled changes which statistics the running collector outputs, taking
+// effect from the next collection pass. It can be used to avoid the
+// stop-the-world cost of reading memory statistics during an expensive phase.
+func SetEnabled(cpu bool, mem bool, gc bool) {
+	if c != nil {
+		c.setEnabled(cpu, mem, gc)
+	}
+}
+
+// Metrics disabled by SetMetricEnabled. The map is replaced rather than
+// changed, so passes read it without locking.
+var (
+	disabledMu      sync.Mutex
+	disabledMetrics atomic.Pointer[map[string]bool]
+)
+
+// SetMetricEnabled enables or disables the output of a single metric by its
+// full key, as sent and listed by SupportedMetrics, such as
+// go.mem.heap.Alloc, taking effect from the next collection pass of every
+// collector. Metrics are all enabled by default. One sent before being
+// disabled still gets its shutdown output. It can be called before
+// collecting starts.
+func SetMetricEnabled(key string, enabled bool) {
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+
+	var next map[string]bool
+	if cur := disabledMetrics.Load(); cur != nil {
+		next = make(map[string]bool, len(*cur)+1)
+		for k := range *cur {
+			next[k] = true
+		}
+	} else {
+		next = make(map[string]bool, 1)
+	}
+	if enabled {
+		delete(next, key)
+	} else {
+		next[key] = true
+	}
+	disabledMetrics.Store(&next)
+}
+
+// MetricEnabled reports whether the metric of full key key is output, as set
+// by SetMetricEnabled.
+func MetricEnabled(key string) bool {
+	disabled := disabledMetrics.Load()
+	return disabled == nil || !(*disabled)[key]
+}
+
+// Stop ends the running collection after the final output selected by
+// OnShutdown, returning once the collector has exited and the sink has
+// drained and closed, each within ShutdownTimeout, so the process can exit
+// without losing the final output. It is safe to call more than once.
+func Stop() {
+	if c != nil {
+		c.stop()
+	}
+}
+
+// Shutdown stops the running collection like Stop, but fails if Collect
+// hasn't been called, for callers wanting to know there was nothing to
+// stop. It is safe to call more than once.
+func Shutdown() error {
+	if c == nil {
+		return errors.New("no collector running")
+	}
+	c.stop()
+	return nil
+}
+
+// Pause makes the running collector skip its passes, along with the reads
+// they make, until Resume, for a maintenance window say. Unlike Stop it
+// keeps the collector running and makes no shutdown output, so the deltas
+// and rates pick up from their last baseline on resuming, spanning the
+// pause. Stop still makes its final output while paused.
+func Pause() {
+	if c != nil {
+		c.paused.Store(true)
+	}
+}
+
+// Resume makes the collector paused by Pause output again from its next
+// pass.
+func Resume() {
+	if c != nil {
+		c.paused.Store(false)
 	}
 }
 
 func Collect(endpoint string, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) error {
-	conn, err := net.DialTimeout("udp", endpoint, 2*time.Second)
+	_, err := startPackage(Config{Endpoint: endpoint, Prefix: prefix, Pause: pauseSeconds(pauseDuration), CPU: cpu, Mem: mem, GC: gc})
+	return err
+}
+
+// CollectTo starts collecting like Collect, but outputs the statistics to
+// sink instead of statsd.
+func CollectTo(sink Sink, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) error {
+	_, err := startPackage(Config{Sink: sink, Prefix: prefix, Pause: pauseSeconds(pauseDuration), CPU: cpu, Mem: mem, GC: gc})
+	return err
+}
+
+// CollectWith starts collecting like Collect, but calls gauge with the full
+// key and value of every metric instead of sending them to statsd, for
+// backends of your own. Calls come from the collection goroutine.
+func CollectWith(gauge GaugeFunc, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) error {
+	_, err := startPackage(Config{Gauge: gauge, Prefix: prefix, Pause: pauseSeconds(pauseDuration), CPU: cpu, Mem: mem, GC: gc})
+	return err
+}
+
+// Clone starts a second collector with the configuration of the running one,
+// outputting to sink under prefix, and returns a function that stops it. It
+// fails if Collect hasn't been called.
+func Clone(sink Sink, prefix string) (stop func(), err error) {
+	if c == nil {
+		return nil, errors.New("no collector to clone")
+	}
+	col := c.clone(prefix, sink)
+	go col.run(context.Background())
+	return col.stop, nil
+}
+
+// OutputFrom makes a collection pass of the running collector using m, for
+// programs already calling runtime.ReadMemStats elsewhere that want to avoid
+// the cost of a second stop-the-world read. The CPU statistics don't stop the
+// world and are read as usual. It returns once the pass is output, or fails
+// if no collector is running.
+func OutputFrom(m *runtime.MemStats) error {
+	col := c
+	if col == nil {
+		return errors.New("no collector running")
+	}
+	select {
+	case col.from <- m:
+	case <-col.exited:
+		return errors.New("collector stopped")
+	}
+	<-col.fromDone
+	return nil
+}
+
+// OutputStats outputs a single pass to sink under prefix, configured from the
+// package options, from the given statistics instead of those of the
+// runtime. A nil cpu or mem leaves the CPU or the memory and GC statistics
+// out. Deltas and rates come out as zero. It turns the output into a
+// deterministic mapping for tests, though metrics not derived from cpu or
+// mem, such as cpu.NumCPU or the runtime/metrics based ones, are still
+// read from the runtime.
+func OutputStats(sink Sink, prefix string, cpu *CPUStats, mem *runtime.MemStats) {
+	col := newCollector(prefix, sink, packageSettings())
+	col.setEnabled(cpu != nil, mem != nil, mem != nil)
+	col.cpuFrom = cpu
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.collect(sectionCPU|sectionMem, mem)
+}
+
+// Run starts collecting like Collect and returns a function that stops the
+// collection, making the final shutdown output and waiting for it to exit.
+func Run(endpoint string, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) (stop func(), err error) {
+	col, err := startPackage(Config{Endpoint: endpoint, Prefix: prefix, Pause: pauseSeconds(pauseDuration), CPU: cpu, Mem: mem, GC: gc})
 	if err != nil {
+		return nil, err
+	}
+	return col.Stop, nil
+}
+
+// RunContext collects like CollectTo, but in the calling goroutine, and
+// returns why it stopped, for supervising code deciding whether to restart
+// or escalate: nil after Stop, the error of ctx once it is done, or an error
+// wrapping ErrSinkFailed once the collector gave up on the sink after
+// BreakerMaxTrips. Stop and a done ctx both make the final output first.
+// With RestartBackoff set, the collector restarts rather than giving up, so
+// ErrSinkFailed is never returned.
+func RunContext(ctx context.Context, sink Sink, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) error {
+	pause := pauseSeconds(pauseDuration)
+	if err := validateStart(pause); err != nil {
 		return err
 	}
+	col := configure(sink, Config{Prefix: prefix, Pause: pause, CPU: cpu, Mem: mem, GC: gc})
+	c = col
+	return col.run(ctx)
+}
 
-	c = newCollector(prefix, conn)
-	c.pauseDur = time.Duration(pauseDuration) * time.Second
-	c.enableCPU = cpu
-	c.enableMem = mem
-	c.enableGC = gc
+// RunUntil collects like RunContext until deadline, for bounded profiling
+// runs, then makes the final output selected by OnShutdown, ShutdownNone
+// leaving the last values in place, and returns nil. History still holds the
+// passes of the run afterwards. It returns early with the error of
+// RunContext if the collector stops otherwise.
+func RunUntil(deadline time.Time, sink Sink, prefix string, pauseDuration int, cpu bool, mem bool, gc bool) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	err := RunContext(ctx, sink, prefix, pauseDuration, cpu, mem, gc)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
 
-	go c.run()
-	return nil
+// startPackage creates and starts a Collector for cfg as the package
+// collector, the one Stop, Pause and the other package functions act on.
+func startPackage(cfg Config) (*Collector, error) {
+	col, err := NewWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	col.Start()
+	c = col.col
+	return col, nil
+}
+
+// pauseSeconds converts the pause of the package functions, in seconds.
+func pauseSeconds(pauseDuration int) time.Duration {
+	return time.Duration(pauseDuration) * time.Second
 }
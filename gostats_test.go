@@ -0,0 +1,326 @@
+package gostats
+
+import (
+	"bytes"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// discardSink drops every metric.
+type discardSink struct{}
+
+func (discardSink) Gauge(key string, value uint64) error { return nil }
+func (discardSink) Flush() error                         { return nil }
+
+func BenchmarkCollect(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkCollect(b, packageSettings())
+	})
+	b.Run("long keys hashed", func(b *testing.B) {
+		s := packageSettings()
+		s.maxKeyLen = 16
+		s.longKeyPolicy = LongKeyHash
+		benchmarkCollect(b, s)
+	})
+}
+
+func benchmarkCollect(b *testing.B, s settings) {
+	col := newCollector("bench", discardSink{}, s)
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.collect(allSections, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		col.collect(allSections, nil)
+	}
+}
+
+func TestRatesUseMonotonicClock(t *testing.T) {
+	values := make(map[string]uint64)
+	col := newCollector("", &funcSink{gauge: func(key string, value uint64) {
+		values[key] = value
+	}}, packageSettings())
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.setEnabled(false, true, false)
+
+	// The wall clock barely moves between the passes, as after a jump
+	// backwards, while the monotonic clock advances by two seconds.
+	var mono time.Duration
+	col.monotonic = func() time.Duration { return mono }
+
+	var m runtime.MemStats
+	m.Mallocs, m.TotalAlloc = 1000, 1<<20
+	col.collect(sectionMem, &m)
+	mono += 2 * time.Second
+	m.Mallocs, m.TotalAlloc = 5000, 5<<20
+	col.collect(sectionMem, &m)
+
+	if got := values["mem.heap.MallocRate"]; got != 2000 {
+		t.Errorf("mem.heap.MallocRate = %d, want 2000", got)
+	}
+	if got := values["mem.com.AllocRate"]; got != 2<<20 {
+		t.Errorf("mem.com.AllocRate = %d, want %d", got, 2<<20)
+	}
+}
+
+func TestMemIntervalKeepsCPUCadence(t *testing.T) {
+	defer func(interval time.Duration, fast bool) {
+		MemInterval, AllowFastInterval = interval, fast
+	}(MemInterval, AllowFastInterval)
+	MemInterval = 100 * time.Millisecond
+	AllowFastInterval = true
+
+	var mu sync.Mutex
+	var cpu, mem int
+	col, err := NewWithConfig(Config{
+		Gauge: func(key string, value uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch key {
+			case "cpu.NumGoroutine":
+				cpu++
+			case "mem.heap.Alloc":
+				mem++
+			}
+		},
+		Pause: 10 * time.Millisecond,
+		CPU:   true,
+		Mem:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.Start()
+	time.Sleep(450 * time.Millisecond)
+	col.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The CPU section ticks ten times as often, allow for timer slack.
+	if mem < 2 || cpu < 3*mem {
+		t.Errorf("got %d CPU and %d memory passes, want the CPU ones every tick and memory every 10th", cpu, mem)
+	}
+}
+
+// batchSink records the metrics of every pass, a batch ending on Flush.
+type batchSink struct {
+	mu      sync.Mutex
+	batches []map[string]uint64
+	current map[string]uint64
+}
+
+func (s *batchSink) Gauge(key string, value uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		s.current = make(map[string]uint64)
+	}
+	s.current[key] = value
+	return nil
+}
+
+func (s *batchSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		s.batches = append(s.batches, s.current)
+		s.current = nil
+	}
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	defer func(col *collector) { c = col }(c)
+	c = nil
+	if err := Shutdown(); err == nil {
+		t.Error("Shutdown before Collect succeeded, want an error")
+	}
+
+	sink := &batchSink{}
+	started := make(chan error)
+	go func() { started <- CollectTo(sink, "test", 1, true, true, true) }()
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	if err := Shutdown(); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if err := Shutdown(); err != nil {
+		t.Errorf("second Shutdown() = %v, want it to be a no-op", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.batches) < 2 {
+		t.Fatalf("got %d batches, want the start and the shutdown ones", len(sink.batches))
+	}
+	final := sink.batches[len(sink.batches)-1]
+	if len(final) == 0 {
+		t.Fatal("final batch is empty")
+	}
+	for key, value := range final {
+		if value != 0 {
+			t.Errorf("final %s = %d, want 0", key, value)
+		}
+	}
+}
+
+func TestGCWithoutMemWarns(t *testing.T) {
+	defer func(logger *slog.Logger) { Logger = logger }(Logger)
+	var buf bytes.Buffer
+	Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	col, err := NewWithConfig(Config{Sink: discardSink{}, Pause: time.Second, CPU: true, GC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.Start()
+	clone := col.col.clone("", discardSink{})
+	clone.osMem.close()
+	clone.cgroupCPU.close()
+	col.Stop()
+
+	if got := strings.Count(buf.String(), "GC statistics are enabled but need memory statistics"); got != 1 {
+		t.Errorf("warned %d times about GC statistics without memory ones, want once:\n%s", got, buf.String())
+	}
+}
+
+func TestGCCPUDeltasWithAbsoluteOnly(t *testing.T) {
+	keys := make(map[string]bool)
+	s := packageSettings()
+	s.deltaMode = AbsoluteOnly
+	s.enableGCCPU = true
+	col := newCollector("", &funcSink{gauge: func(key string, value uint64) {
+		keys[key] = true
+	}}, s)
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.setEnabled(false, true, true)
+
+	var m runtime.MemStats
+	for i := 0; i < 2; i++ {
+		runtime.ReadMemStats(&m)
+		col.collect(sectionMem, &m)
+	}
+
+	for _, key := range []string{"mem.gc.cpu.TotalNs", "mem.gc.cpu.TotalNs.delta", "mem.gc.cpu.MarkAssistNs.delta"} {
+		if !keys[key] {
+			t.Errorf("%s not output", key)
+		}
+	}
+	if keys["mem.heap.Mallocs.delta"] {
+		t.Error("mem.heap.Mallocs.delta output with AbsoluteOnly")
+	}
+}
+
+func TestShutdownSkipsHeldBackKeys(t *testing.T) {
+	sink := &batchSink{}
+	s := packageSettings()
+	s.shutdownMode = ShutdownZero
+	s.thresholdsAbove = map[string]uint64{"test.cpu.NumGoroutine": 1 << 40}
+	col := newCollector("test", sink, s)
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.setEnabled(true, false, false)
+
+	col.collect(sectionCPU, nil)
+	col.zeroStats()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	final := sink.batches[len(sink.batches)-1]
+	if _, ok := final["test.cpu.NumGoroutine"]; ok {
+		t.Error("shutdown zeroed test.cpu.NumGoroutine, held back by its threshold")
+	}
+	if v, ok := final["test.cpu.NumCPU"]; !ok || v != 0 {
+		t.Errorf("shutdown sent test.cpu.NumCPU = %d, %t, want 0", v, ok)
+	}
+}
+
+func TestSetEnabledFloorsMemInterval(t *testing.T) {
+	var mu sync.Mutex
+	var cpu, mem int
+	col, err := NewWithConfig(Config{
+		Gauge: func(key string, value uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch key {
+			case "cpu.NumGoroutine":
+				cpu++
+			case "mem.heap.Alloc":
+				// Leaving out the shutdown flush.
+				if value > 0 {
+					mem++
+				}
+			}
+		},
+		Pause: 10 * time.Millisecond,
+		CPU:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.Start()
+	col.col.setEnabled(true, true, false)
+	time.Sleep(450 * time.Millisecond)
+	col.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Memory passes no closer than MinMemInterval, allow for timer slack.
+	if max := int(450*time.Millisecond/MinMemInterval) + 1; mem < 1 || mem > max || cpu < 3*mem {
+		t.Errorf("got %d CPU and %d memory passes, want memory ones at most every %v", cpu, mem, MinMemInterval)
+	}
+}
+
+func TestSchedStats(t *testing.T) {
+	defer func(enabled bool) { SchedStats = enabled }(SchedStats)
+	keys := []string{"test.cpu.GOMAXPROCS", "test.cpu.SchedLatency", "test.cpu.GCCPUFraction"}
+	for _, enabled := range []bool{false, true} {
+		SchedStats = enabled
+		sink := &batchSink{}
+		col := newCollector("test", sink, packageSettings())
+		col.setEnabled(true, true, true)
+		col.collect(sectionCPU|sectionMem, nil)
+		col.osMem.close()
+		col.cgroupCPU.close()
+
+		for _, key := range keys {
+			if _, ok := sink.batches[0][key]; ok != enabled {
+				t.Errorf("with SchedStats %t, %s output = %t", enabled, key, ok)
+			}
+		}
+	}
+}
+
+func TestPerIntervalCounts(t *testing.T) {
+	sink := &batchSink{}
+	col := newCollector("test", sink, packageSettings())
+	defer col.osMem.close()
+	defer col.cgroupCPU.close()
+	col.setEnabled(false, true, true)
+
+	col.collect(sectionMem, &runtime.MemStats{Mallocs: 1000, Frees: 400, NumGC: 10})
+	col.collect(sectionMem, &runtime.MemStats{Mallocs: 1500, Frees: 700, NumGC: 12})
+
+	want := []map[string]uint64{
+		{"test.mem.heap.MallocsPerInterval": 0, "test.mem.heap.FreesPerInterval": 0, "test.mem.gc.NumGCPerInterval": 0},
+		{"test.mem.heap.MallocsPerInterval": 500, "test.mem.heap.FreesPerInterval": 300, "test.mem.gc.NumGCPerInterval": 2},
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	for i, keys := range want {
+		for key, value := range keys {
+			if got, ok := sink.batches[i][key]; !ok || got != value {
+				t.Errorf("pass %d sent %s = %d, %t, want %d", i+1, key, got, ok, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package gostats
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler returns an http.Handler making the process a scrape target rather
+// than pushing to statsd. Every GET runs a collection pass, configured from
+// the package options with every section enabled, and writes its metrics
+// under prefix in the format the Accept header asks for:
+//
+//   - application/json: a JSON object as written by JSONSink,
+//   - application/openmetrics-text: the OpenMetrics exposition format,
+//   - text/plain;version=0.0.4: the Prometheus text exposition format,
+//   - anything else: plain text "key value" lines.
+//
+// Deltas and rates are measured since the previous scrape, and concurrent
+// scrapes are served one at a time. The registered sources and gauges are
+// called by a scrape only while no collector calls them. It is typically
+// mounted at /metrics or /debug/stats.
+func Handler(prefix string) http.Handler {
+	return NewHandler(Config{Prefix: prefix, CPU: true, Mem: true, GC: true})
+}
+
+// NewHandler returns a Handler for the prefix and sections of cfg, leaving
+// out the CPU, memory or GC statistics it doesn't enable. The endpoint, sink
+// and pause of cfg are ignored, scrapes driving the collection. Handlers
+// serve their scrapes independently, but call the registered sources and
+// gauges one at a time like Handler does.
+func NewHandler(cfg Config) http.Handler {
+	h := &scrapeHandler{}
+	h.col = newCollector(strings.TrimSuffix(cfg.Prefix, "."), &h.sink, packageSettings())
+	h.col.setEnabled(cfg.CPU, cfg.Mem, cfg.GC)
+	return h
+}
+
+type scrapeHandler struct {
+	mu   sync.Mutex
+	col  *collector
+	sink scrapeSink
+	buf  bytes.Buffer
+}
+
+// scrapeSink holds the metrics of the pass being scraped.
+type scrapeSink struct {
+	metrics  []promSample
+	ts       time.Time
+	duration time.Duration
+}
+
+func (s *scrapeSink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *scrapeSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	s.ts = ts
+	s.metrics = append(s.metrics, promSample{key, value})
+	return nil
+}
+
+func (s *scrapeSink) CollectDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *scrapeSink) Flush() error {
+	return nil
+}
+
+func (h *scrapeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sink.metrics = h.sink.metrics[:0]
+	h.sink.duration = 0
+	h.col.collect(allSections, nil)
+	h.buf.Reset()
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		w.Header().Set("Content-Type", "application/json")
+		js := NewJSONSink(&h.buf)
+		for _, m := range h.sink.metrics {
+			js.GaugeAt(m.name, m.value, h.sink.ts)
+		}
+		js.Flush()
+	case strings.Contains(accept, "application/openmetrics-text"):
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		writeExposition(&h.buf, h.promSamples(), h.sink.duration)
+		h.buf.WriteString("# EOF\n")
+	case strings.Contains(accept, "version=0.0.4"):
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeExposition(&h.buf, h.promSamples(), h.sink.duration)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, m := range h.sink.metrics {
+			h.buf.WriteString(m.name)
+			h.buf.WriteByte(' ')
+			h.buf.WriteString(strconv.FormatUint(m.value, 10))
+			h.buf.WriteByte('\n')
+		}
+	}
+	w.Write(h.buf.Bytes())
+}
+
+// promSamples translates the keys of the scraped metrics to Prometheus
+// names, in place as they aren't needed afterwards.
+func (h *scrapeHandler) promSamples() []promSample {
+	for i := range h.sink.metrics {
+		h.sink.metrics[i].name = prometheusName(h.sink.metrics[i].name)
+	}
+	return h.sink.metrics
+}
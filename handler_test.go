@@ -0,0 +1,98 @@
+package gostats
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewHandlerExposition(t *testing.T) {
+	h := NewHandler(Config{Prefix: "go", CPU: true})
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", got)
+	}
+
+	name := regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	samples := make(map[string]bool)
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if typ, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			fields := strings.Fields(typ)
+			if len(fields) != 2 || !name.MatchString(fields[0]) {
+				t.Errorf("malformed TYPE line %q", line)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !name.MatchString(fields[0]) {
+			t.Errorf("malformed sample line %q", line)
+			continue
+		}
+		if _, err := strconv.ParseFloat(fields[1], 64); err != nil {
+			t.Errorf("malformed value in %q: %v", line, err)
+		}
+		samples[fields[0]] = true
+	}
+
+	if !samples["go_cpu_numgoroutine"] {
+		t.Error("go_cpu_numgoroutine missing from the exposition")
+	}
+	for s := range samples {
+		if strings.HasPrefix(s, "go_mem_") {
+			t.Errorf("memory metric %s exposed with the memory section disabled", s)
+		}
+	}
+}
+
+// scrapeConcurrently scrapes every handler from several goroutines while a
+// collector runs, failing the test if s saw overlapping calls.
+func scrapeConcurrently(t *testing.T, s *overlapSource, handlers ...http.Handler) {
+	t.Helper()
+	col, err := NewWithConfig(Config{Sink: discardSink{}, Pause: time.Millisecond, CPU: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.Start()
+	var wg sync.WaitGroup
+	for _, h := range handlers {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(h http.Handler) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+				}
+			}(h)
+		}
+	}
+	wg.Wait()
+	col.Stop()
+
+	if max := s.max.Load(); max > 1 {
+		t.Errorf("%d Source.Collect calls overlapped, want none", max)
+	}
+}
+
+func TestHandlerDoesntOverlapCollection(t *testing.T) {
+	s := registerOverlapSource(t)
+	scrapeConcurrently(t, s, Handler("test"))
+}
+
+func TestNewHandlersDontOverlap(t *testing.T) {
+	s := registerOverlapSource(t)
+	scrapeConcurrently(t, s,
+		NewHandler(Config{Prefix: "a", CPU: true}),
+		NewHandler(Config{Prefix: "b", CPU: true, Mem: true, GC: true}))
+}
@@ -0,0 +1,116 @@
+package gostats
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// HistorySize is the number of past collection passes kept in memory for
+// History, zero disables the history.
+var HistorySize = 0
+
+// Snapshot holds the value of every key output in a collection pass.
+type Snapshot map[string]uint64
+
+// Diff returns the signed change of every key from snapshot a to b, b minus
+// a, to compare the passes around an operation such as one suspected of
+// leaking. A key missing from one of the snapshots counts as zero there.
+// Changes beyond the range of an int64 are clamped to it.
+func Diff(a, b Snapshot) map[string]int64 {
+	d := make(map[string]int64, len(b))
+	for key, vb := range b {
+		d[key] = signedSub(vb, a[key])
+	}
+	for key, va := range a {
+		if _, ok := b[key]; !ok {
+			d[key] = signedSub(0, va)
+		}
+	}
+	return d
+}
+
+// signedSub returns b - a clamped to the range of an int64.
+func signedSub(b uint64, a uint64) int64 {
+	if b >= a {
+		if b-a > math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return int64(b - a)
+	}
+	if a-b > 1<<63 {
+		return math.MinInt64
+	}
+	return -int64(a-b-1) - 1
+}
+
+// TimestampedSnapshot is a Snapshot along with the time of its pass.
+type TimestampedSnapshot struct {
+	Time   time.Time
+	Values Snapshot
+}
+
+// history is a ring of the most recent snapshots.
+type history struct {
+	mu    sync.Mutex
+	ring  []TimestampedSnapshot
+	next  int
+	count int
+}
+
+func newHistory(size int) *history {
+	return &history{ring: make([]TimestampedSnapshot, size)}
+}
+
+func (h *history) add(s TimestampedSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ring[h.next] = s
+	h.next = (h.next + 1) % len(h.ring)
+	if h.count < len(h.ring) {
+		h.count++
+	}
+}
+
+// snapshots returns the kept snapshots, oldest first.
+func (h *history) snapshots() []TimestampedSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]TimestampedSnapshot, 0, h.count)
+	start := (h.next - h.count + len(h.ring)) % len(h.ring)
+	for i := 0; i < h.count; i++ {
+		out = append(out, h.ring[(start+i)%len(h.ring)])
+	}
+	return out
+}
+
+// History returns the last HistorySize collection passes of the running
+// collector, oldest first. It is empty if the history is disabled.
+func History() []TimestampedSnapshot {
+	if c == nil || c.history == nil {
+		return nil
+	}
+	return c.history.snapshots()
+}
+
+// record adds a metric to the snapshot of the current pass.
+func (c *collector) record(key string, value uint64) {
+	if c.history == nil {
+		return
+	}
+	if c.pass == nil {
+		c.pass = make(Snapshot)
+	}
+	c.pass[key] = value
+}
+
+// endPass moves the snapshot of the current pass into the history.
+func (c *collector) endPass() {
+	if c.history == nil || c.pass == nil {
+		return
+	}
+	c.history.add(TimestampedSnapshot{Time: c.passTime, Values: c.pass})
+	c.pass = nil
+}
@@ -0,0 +1,85 @@
+package gostats
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxSink writes the metrics in the InfluxDB line protocol, one
+// measurement per metric with its value as an integer field, along with the
+// Tags as Influx tags so the data is queryable by dimension, host, service
+// and env say:
+//
+//	go.mem.heap.Alloc,env=prod,host=web1 value=123456i 1676455200000000000
+//
+// Commas and spaces are escaped in keys, and equal signs too in tags, as the
+// line protocol requires. Values above the largest int64 are clamped. Every
+// pass is written at once on Flush.
+type InfluxSink struct {
+	w    io.Writer
+	tags string
+	buf  bytes.Buffer
+}
+
+// Escapers of the characters significant in the measurements, and in the
+// tag keys and values of the line protocol.
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxEscaper            = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// NewInfluxSink returns a sink writing line protocol to w, with the Tags as
+// they are at the time of the call, for use with CollectTo.
+func NewInfluxSink(w io.Writer) *InfluxSink {
+	return &InfluxSink{w: w, tags: influxTags(Tags)}
+}
+
+// influxTags serializes tags sorted by key, as Influx recommends for
+// performance, with the leading comma.
+func influxTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteByte(',')
+		b.WriteString(influxEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxEscaper.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+func (s *InfluxSink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *InfluxSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	s.buf.WriteString(influxMeasurementEscaper.Replace(key))
+	s.buf.WriteString(s.tags)
+	s.buf.WriteString(" value=")
+	// Integer fields are signed, larger values are clamped.
+	s.buf.WriteString(strconv.FormatUint(min(value, math.MaxInt64), 10))
+	s.buf.WriteString("i ")
+	s.buf.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	s.buf.WriteByte('\n')
+	return nil
+}
+
+func (s *InfluxSink) Flush() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	defer s.buf.Reset()
+
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
@@ -0,0 +1,55 @@
+package gostats
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// JSONSink writes every collection pass as a single line JSON object
+// holding the pass timestamp under "ts" followed by every metric:
+//
+//	{"ts":"2023-02-15T10:00:00Z","go.cpu.NumGoroutine":12,...}
+type JSONSink struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewJSONSink returns a sink writing JSON lines to w, for use with CollectTo.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+func (s *JSONSink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *JSONSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	if s.buf.Len() == 0 {
+		s.buf.WriteString(`{"ts":`)
+		s.buf.WriteString(strconv.Quote(ts.UTC().Format(time.RFC3339Nano)))
+	}
+
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	s.buf.WriteByte(',')
+	s.buf.Write(k)
+	s.buf.WriteByte(':')
+	s.buf.WriteString(strconv.FormatUint(value, 10))
+	return nil
+}
+
+func (s *JSONSink) Flush() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	defer s.buf.Reset()
+
+	s.buf.WriteString("}\n")
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
@@ -0,0 +1,76 @@
+package gostats
+
+import "strings"
+
+// Scheme is a naming scheme of the built-in metrics.
+type Scheme int
+
+const (
+	// SchemeNative names the metrics as documented by Describe.
+	SchemeNative Scheme = iota
+
+	// SchemeGoRuntimeMetrics names the metrics it has in common with
+	// github.com/bmhatfield/go-runtime-metrics as that library does, for
+	// example mem.heap.alloc for mem.heap.HeapAlloc, so dashboards and
+	// alerts built on it keep working. The mapping is listed in
+	// goRuntimeMetricsNames; the other metrics keep their native name.
+	SchemeGoRuntimeMetrics
+)
+
+// KeyScheme selects the naming scheme of the built-in metrics. Delta keys
+// keep their .delta suffix whatever the scheme. CompactKeys only applies to
+// the metrics the scheme leaves with their native name.
+var KeyScheme = SchemeNative
+
+// goRuntimeMetricsNames maps the native buckets to those of
+// go-runtime-metrics.
+var goRuntimeMetricsNames = map[string]string{
+	"cpu.NumGoroutine": "cpu.goroutines",
+	"cpu.NumCgoCall":   "cpu.cgo_calls",
+
+	"mem.heap.Alloc":      "mem.alloc",
+	"mem.heap.TotalAlloc": "mem.total",
+	"mem.sys.Sys":         "mem.sys",
+	"mem.sys.Lookups":     "mem.lookups",
+	"mem.heap.Mallocs":    "mem.malloc",
+	"mem.heap.Frees":      "mem.frees",
+	"mem.sys.OtherSys":    "mem.othersys",
+
+	"mem.heap.HeapAlloc":    "mem.heap.alloc",
+	"mem.heap.HeapSys":      "mem.heap.sys",
+	"mem.heap.HeapIdle":     "mem.heap.idle",
+	"mem.heap.HeapInuse":    "mem.heap.inuse",
+	"mem.heap.HeapReleased": "mem.heap.released",
+	"mem.heap.HeapObjects":  "mem.heap.objects",
+
+	"mem.stack.StackInuse":  "mem.stack.inuse",
+	"mem.stack.StackSys":    "mem.stack.sys",
+	"mem.stack.MSpanInuse":  "mem.stack.mspan_inuse",
+	"mem.stack.MSpanSys":    "mem.stack.mspan_sys",
+	"mem.stack.MCacheInuse": "mem.stack.mcache_inuse",
+	"mem.stack.MCacheSys":   "mem.stack.mcache_sys",
+
+	"mem.gc.GCSys":        "mem.gc.sys",
+	"mem.gc.NextGC":       "mem.gc.next",
+	"mem.gc.LastGC":       "mem.gc.last",
+	"mem.gc.PauseTotalNs": "mem.gc.pause_total",
+	"mem.gc.Pause":        "mem.gc.pause",
+	"mem.gc.NumGC":        "mem.gc.count",
+}
+
+// schemeName returns the name of bucket in scheme, and whether the scheme
+// renames it.
+func schemeName(scheme Scheme, bucket string) (string, bool) {
+	if scheme != SchemeGoRuntimeMetrics {
+		return bucket, false
+	}
+	if name, ok := goRuntimeMetricsNames[bucket]; ok {
+		return name, true
+	}
+	if base, found := strings.CutSuffix(bucket, ".delta"); found {
+		if name, ok := goRuntimeMetricsNames[base]; ok {
+			return name + ".delta", true
+		}
+	}
+	return bucket, false
+}
@@ -0,0 +1,212 @@
+package gostats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// MultiSink hands every metric to several sinks, for dual writing to more
+// than one backend from a single collector. Each sink is given what it
+// supports: timestamps to timestamped sinks and counters to counter sinks,
+// the others getting plain gauges. Wrapping a sink in WithSeparator or
+// WithSanitize adapts the keys to its backend alone.
+type MultiSink struct {
+	sinks []Sink
+}
+
+// Multi returns a sink writing to every one of sinks, for use with
+// CollectTo. A failing sink doesn't keep the metric from the others; the
+// errors are joined.
+func Multi(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+func (s *MultiSink) Gauge(key string, value uint64) error {
+	var err error
+	for _, sink := range s.sinks {
+		if e := sink.Gauge(key, value); e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
+
+func (s *MultiSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	var err error
+	for _, sink := range s.sinks {
+		var e error
+		if tsink, ok := sink.(TimestampedSink); ok {
+			e = tsink.GaugeAt(key, value, ts)
+		} else {
+			e = sink.Gauge(key, value)
+		}
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
+
+func (s *MultiSink) Count(key string, delta uint64) error {
+	var err error
+	for _, sink := range s.sinks {
+		var e error
+		if cs, ok := sink.(CounterSink); ok {
+			e = cs.Count(key, delta)
+		} else {
+			e = sink.Gauge(key, delta)
+		}
+		if e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
+
+func (s *MultiSink) Flush() error {
+	var err error
+	for _, sink := range s.sinks {
+		if e := sink.Flush(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
+
+// CollectDuration tells the sinks that record it how long the pass took.
+func (s *MultiSink) CollectDuration(d time.Duration) {
+	for _, sink := range s.sinks {
+		if ds, ok := sink.(durationSink); ok {
+			ds.CollectDuration(d)
+		}
+	}
+}
+
+func (s *MultiSink) SetWriteDeadline(t time.Time) error {
+	var err error
+	for _, sink := range s.sinks {
+		if d, ok := sink.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+			if e := d.SetWriteDeadline(t); e != nil {
+				err = errors.Join(err, e)
+			}
+		}
+	}
+	return err
+}
+
+// Drain drains the sinks that buffer metrics, adding up their counts.
+func (s *MultiSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	for _, sink := range s.sinks {
+		if d, ok := sink.(Drainer); ok {
+			f, n, e := d.Drain(ctx)
+			flushed += f
+			dropped += n
+			if e != nil {
+				err = errors.Join(err, e)
+			}
+		}
+	}
+	return flushed, dropped, err
+}
+
+func (s *MultiSink) Close() error {
+	var err error
+	for _, sink := range s.sinks {
+		if cl, ok := sink.(io.Closer); ok {
+			if e := cl.Close(); e != nil {
+				err = errors.Join(err, e)
+			}
+		}
+	}
+	return err
+}
+
+// KeyRewritingSink rewrites every key before handing the metric to the sink
+// it wraps, as returned by WithSeparator and WithSanitize. Each key is
+// rewritten once and cached.
+type KeyRewritingSink struct {
+	next    Sink
+	rewrite func(key string) string
+	keys    map[string]string
+}
+
+// WithSeparator returns a sink replacing the dots between the parts of every
+// key with sep before writing to next, for example an underscore for a
+// Prometheus sink written to along with a Graphite one.
+func WithSeparator(sep string, next Sink) *KeyRewritingSink {
+	return WithSanitize(func(key string) string {
+		return strings.ReplaceAll(key, ".", sep)
+	}, next)
+}
+
+// WithSanitize returns a sink rewriting every key with sanitize, such as
+// SanitizePrometheus, before writing to next. Unlike the package Sanitize
+// it only applies to next.
+func WithSanitize(sanitize func(key string) string, next Sink) *KeyRewritingSink {
+	return &KeyRewritingSink{
+		next:    next,
+		rewrite: sanitize,
+		keys:    make(map[string]string),
+	}
+}
+
+func (s *KeyRewritingSink) key(key string) string {
+	k, ok := s.keys[key]
+	if !ok {
+		k = s.rewrite(key)
+		s.keys[key] = k
+	}
+	return k
+}
+
+func (s *KeyRewritingSink) Gauge(key string, value uint64) error {
+	return s.next.Gauge(s.key(key), value)
+}
+
+func (s *KeyRewritingSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	if next, ok := s.next.(TimestampedSink); ok {
+		return next.GaugeAt(s.key(key), value, ts)
+	}
+	return s.next.Gauge(s.key(key), value)
+}
+
+func (s *KeyRewritingSink) Count(key string, delta uint64) error {
+	if next, ok := s.next.(CounterSink); ok {
+		return next.Count(s.key(key), delta)
+	}
+	return s.next.Gauge(s.key(key), delta)
+}
+
+func (s *KeyRewritingSink) Flush() error {
+	return s.next.Flush()
+}
+
+func (s *KeyRewritingSink) CollectDuration(d time.Duration) {
+	if next, ok := s.next.(durationSink); ok {
+		next.CollectDuration(d)
+	}
+}
+
+func (s *KeyRewritingSink) SetWriteDeadline(t time.Time) error {
+	if next, ok := s.next.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		return next.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (s *KeyRewritingSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	if next, ok := s.next.(Drainer); ok {
+		return next.Drain(ctx)
+	}
+	return 0, 0, nil
+}
+
+func (s *KeyRewritingSink) Close() error {
+	if next, ok := s.next.(io.Closer); ok {
+		return next.Close()
+	}
+	return nil
+}
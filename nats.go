@@ -0,0 +1,85 @@
+package gostats
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// NATSPublisher publishes a message to a NATS subject, as *nats.Conn of the
+// NATS client does. It is an interface so the package doesn't depend on the
+// client, whose connection options then govern connecting, reconnecting and
+// buffering while disconnected.
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink publishes every collection pass to a NATS subject as a JSON
+// object in the format of JSONSink, putting the runtime statistics on an
+// existing NATS telemetry bus. Publishing is fire and forget, from a
+// goroutine of its own so the collection never waits on the connection;
+// passes that find the queue full are dropped and counted by Dropped, and
+// failed publishes are logged.
+type NATSSink struct {
+	conn    NATSPublisher
+	subject string
+
+	body  bytes.Buffer
+	json  *JSONSink
+	queue *asyncQueue[[]byte]
+}
+
+// NewNATSSink returns a sink publishing to subject through conn, for use
+// with CollectTo.
+func NewNATSSink(conn NATSPublisher, subject string) *NATSSink {
+	s := &NATSSink{
+		conn:    conn,
+		subject: subject,
+	}
+	s.json = NewJSONSink(&s.body)
+	s.queue = newAsyncQueue(s.publish)
+	return s
+}
+
+func (s *NATSSink) Gauge(key string, value uint64) error {
+	return s.json.Gauge(key, value)
+}
+
+func (s *NATSSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	return s.json.GaugeAt(key, value, ts)
+}
+
+func (s *NATSSink) Flush() error {
+	if err := s.json.Flush(); err != nil {
+		return err
+	}
+	if s.body.Len() == 0 {
+		return nil
+	}
+	s.queue.push(bytes.Clone(s.body.Bytes()))
+	s.body.Reset()
+	return nil
+}
+
+// Drain waits for the queued passes to be published until ctx is done.
+func (s *NATSSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	return s.queue.drain(ctx)
+}
+
+// Close publishes the passes still queued and stops the publishing
+// goroutine. The connection is left open, it belongs to the caller.
+func (s *NATSSink) Close() error {
+	s.queue.close()
+	return nil
+}
+
+// Dropped returns the number of passes dropped because the queue was full.
+func (s *NATSSink) Dropped() uint64 {
+	return s.queue.dropped.Load()
+}
+
+func (s *NATSSink) publish(msg []byte) {
+	if err := s.conn.Publish(s.subject, msg); err != nil {
+		Logger.Error("error publishing to nats", "subject", s.subject, "error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gostats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// OpenMetricsSink renders the metrics of the last complete collection pass
+// in the OpenMetrics text exposition format, with key names translated as
+// for Prometheus and the duration of the pass as
+// go_stats_collect_duration_seconds. The pass is written out after every
+// collection to the writer or file it was created with, and on demand with
+// WriteTo, which lets node_exporter's textfile collector and the like pick
+// up the statistics without an HTTP server in the process. The zeroed gauges of a stopping
+// collector are written out too unless OnShutdown is ShutdownNone.
+type OpenMetricsSink struct {
+	w    io.Writer
+	path string
+
+	current  []promSample
+	duration time.Duration
+
+	mu   sync.Mutex
+	last []promSample
+	buf  bytes.Buffer
+}
+
+// NewOpenMetricsSink returns a sink writing every pass to w, for use with
+// CollectTo. w may be nil to only render passes on demand with WriteTo.
+func NewOpenMetricsSink(w io.Writer) *OpenMetricsSink {
+	return &OpenMetricsSink{w: w}
+}
+
+// NewOpenMetricsFile returns a sink replacing the file at path with every
+// pass. The file is replaced atomically through a temporary file next to it,
+// so readers never see a partial pass.
+func NewOpenMetricsFile(path string) *OpenMetricsSink {
+	return &OpenMetricsSink{path: path}
+}
+
+func (s *OpenMetricsSink) Gauge(key string, value uint64) error {
+	s.current = append(s.current, promSample{prometheusName(key), value})
+	return nil
+}
+
+// CollectDuration records how long the pass took, written as
+// go_stats_collect_duration_seconds.
+func (s *OpenMetricsSink) CollectDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *OpenMetricsSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last, s.current = s.current, s.last[:0]
+	s.buf.Reset()
+	writeExposition(&s.buf, s.last, s.duration)
+	s.duration = 0
+	s.buf.WriteString("# EOF\n")
+
+	switch {
+	case s.w != nil:
+		_, err := s.w.Write(s.buf.Bytes())
+		return err
+	case s.path != "":
+		return s.replaceFile()
+	}
+	return nil
+}
+
+// replaceFile writes the rendered pass to the sink's file.
+func (s *OpenMetricsSink) replaceFile() error {
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, s.buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// WriteTo writes the last complete pass to w. It is safe to call while the
+// collector runs, for example from an HTTP handler.
+func (s *OpenMetricsSink) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := w.Write(s.buf.Bytes())
+	return int64(n), err
+}
@@ -0,0 +1,17 @@
+package gostats
+
+// EnableOSMem makes the collector output the resident set size and virtual
+// memory size reported by the OS, as mem.os.RSSBytes and mem.os.VSizeBytes.
+// Unlike the runtime figures these match what cgroup limits are enforced
+// against. Only supported on Linux, where they are read from
+// /proc/self/statm; it does nothing elsewhere.
+var EnableOSMem = false
+
+func (c *collector) outputOSMemStats() {
+	rss, vsize, ok := c.osMem.read(c)
+	if !ok {
+		return
+	}
+	c.send("mem.os.RSSBytes", rss)
+	c.send("mem.os.VSizeBytes", vsize)
+}
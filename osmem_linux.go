@@ -0,0 +1,68 @@
+//go:build linux
+
+package gostats
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// osMemReader reads /proc/self/statm, keeping it open between passes.
+type osMemReader struct {
+	f      *os.File
+	failed bool
+	buf    [128]byte
+}
+
+// read returns the resident and virtual memory sizes in bytes.
+func (r *osMemReader) read(c *collector) (rss uint64, vsize uint64, ok bool) {
+	if r.failed {
+		return 0, 0, false
+	}
+	if r.f == nil {
+		f, err := os.Open("/proc/self/statm")
+		if err != nil {
+			c.logger.Warn("error opening /proc/self/statm, OS memory stats disabled", "error", err)
+			r.failed = true
+			return 0, 0, false
+		}
+		r.f = f
+	}
+
+	n, err := r.f.ReadAt(r.buf[:], 0)
+	if err != nil && err != io.EOF {
+		c.logger.Warn("error reading /proc/self/statm", "error", err)
+		return 0, 0, false
+	}
+
+	// The first two fields are the total and resident sizes in pages.
+	size, rest, ok := parseField(r.buf[:n])
+	if !ok {
+		return 0, 0, false
+	}
+	resident, _, ok := parseField(rest)
+	if !ok {
+		return 0, 0, false
+	}
+	page := uint64(os.Getpagesize())
+	return resident * page, size * page, true
+}
+
+// parseField parses the leading space separated decimal number of b,
+// returning what follows it.
+func parseField(b []byte) (v uint64, rest []byte, ok bool) {
+	b = bytes.TrimLeft(b, " ")
+	i := 0
+	for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+		v = v*10 + uint64(b[i]-'0')
+		i++
+	}
+	return v, b[i:], i > 0
+}
+
+func (r *osMemReader) close() {
+	if r.f != nil {
+		r.f.Close()
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package gostats
+
+// osMemReader reads nothing, the OS memory stats being Linux only.
+type osMemReader struct{}
+
+func (r *osMemReader) read(c *collector) (rss uint64, vsize uint64, ok bool) {
+	return 0, 0, false
+}
+
+func (r *osMemReader) close() {}
@@ -0,0 +1,74 @@
+package gostats
+
+import "runtime"
+
+// EnableBlockProfile makes the collector output the blocking events recorded
+// by the block profile, along with the CPU statistics, as the cumulative
+// cpu.BlockEvents and cpu.BlockCyclesTotal, the CPU cycles spent blocked.
+// The profile only records events once the program sets a rate with
+// runtime.SetBlockProfileRate, which the collector leaves alone; both are
+// zero until then. Every pass copies the whole profile, one record per
+// distinct blocking call stack, so the cost grows with the number of call
+// sites blocking, on top of the overhead of the profiling rate itself.
+var EnableBlockProfile = false
+
+// EnableMutexProfile makes the collector output the lock contention recorded
+// by the mutex profile, along with the CPU statistics, as the cumulative
+// cpu.MutexContentionEvents and cpu.MutexContentionCycles, the CPU cycles
+// spent waiting on contended locks. The profile is only read while the
+// program has set a fraction with runtime.SetMutexProfileFraction, which the
+// collector leaves alone; both stay at their last value otherwise.
+// Reading it costs as reading the block profile does.
+var EnableMutexProfile = false
+
+// profileTotals sums a contention profile over its records.
+type profileTotals struct {
+	// Records read every pass, reused.
+	records []runtime.BlockProfileRecord
+
+	// Totals of the previous pass.
+	events uint64
+	cycles uint64
+}
+
+// read returns the total events and cycles of the profile read reads.
+func (p *profileTotals) read(read func([]runtime.BlockProfileRecord) (int, bool)) (events uint64, cycles uint64) {
+	n, ok := read(p.records)
+	for !ok {
+		// Room for records added between the calls.
+		p.records = make([]runtime.BlockProfileRecord, n+n/4+8)
+		n, ok = read(p.records)
+	}
+	for _, r := range p.records[:n] {
+		events += uint64(r.Count)
+		cycles += uint64(r.Cycles)
+	}
+	return events, cycles
+}
+
+// outputProfile outputs the totals of a contention profile as counters.
+func (c *collector) outputProfile(p *profileTotals, read func([]runtime.BlockProfileRecord) (int, bool), eventsBucket string, cyclesBucket string) {
+	events, cycles := p.read(read)
+	// The first pass has nothing to compare with, its delta is zero.
+	if c.cpuPasses == 1 {
+		p.events, p.cycles = events, cycles
+	}
+	c.sendCounter(eventsBucket, events, p.events)
+	c.sendCounter(cyclesBucket, cycles, p.cycles)
+	p.events, p.cycles = events, cycles
+}
+
+func (c *collector) outputBlockProfile() {
+	c.outputProfile(&c.blockProfile, runtime.BlockProfile, "cpu.BlockEvents", "cpu.BlockCyclesTotal")
+}
+
+func (c *collector) outputMutexProfile() {
+	if runtime.SetMutexProfileFraction(-1) == 0 {
+		// Not profiling, the totals stay where they were, zero if never
+		// profiled.
+		c.sendCounter("cpu.MutexContentionEvents", c.mutexProfile.events, c.mutexProfile.events)
+		c.sendCounter("cpu.MutexContentionCycles", c.mutexProfile.cycles, c.mutexProfile.cycles)
+		return
+	}
+	c.outputProfile(&c.mutexProfile, runtime.MutexProfile, "cpu.MutexContentionEvents", "cpu.MutexContentionCycles")
+}
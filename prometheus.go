@@ -0,0 +1,129 @@
+package gostats
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// prometheusName converts a dotted key such as go.mem.heap.Alloc into a
+// valid Prometheus metric name such as go_mem_heap_alloc.
+func prometheusName(key string) string {
+	b := []byte(strings.ToLower(key))
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch == '_' || ch == ':' || ch >= '0' && ch <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// collectDurationName is the metric the Prometheus sinks report how long
+// the collection pass took under, in the unit and naming of the ecosystem.
+const collectDurationName = "go_stats_collect_duration_seconds"
+
+// durationSink is a Sink told how long every collection pass took, right
+// before the pass is flushed.
+type durationSink interface {
+	CollectDuration(d time.Duration)
+}
+
+// writeExposition renders samples in the Prometheus text exposition format,
+// followed by the duration of the pass unless zero.
+func writeExposition(b *bytes.Buffer, samples []promSample, duration time.Duration) {
+	for _, m := range samples {
+		fmt.Fprintf(b, "# TYPE %s gauge\n%s %d\n", m.name, m.name, m.value)
+	}
+	if duration > 0 {
+		fmt.Fprintf(b, "# TYPE %s gauge\n%s %g\n", collectDurationName, collectDurationName, duration.Seconds())
+	}
+}
+
+// PushgatewaySink pushes the metrics to a Prometheus Pushgateway, for batch
+// jobs that live too briefly to be scraped. The last complete pass is pushed
+// when the collector stops, and after every pass if PushEveryInterval is set.
+// Use it with OnShutdown set to ShutdownSticky or ShutdownNone, the zeroed
+// gauges get pushed otherwise.
+type PushgatewaySink struct {
+	// PushEveryInterval pushes after every collection pass, not only when
+	// the collector stops.
+	PushEveryInterval bool
+
+	// Client is the HTTP client used to push, defaults to one with a ten
+	// second timeout.
+	Client *http.Client
+
+	url     string
+	current []promSample
+	last    []promSample
+
+	// Duration of the current and last complete pass.
+	duration     time.Duration
+	lastDuration time.Duration
+}
+
+type promSample struct {
+	name  string
+	value uint64
+}
+
+// NewPushgatewaySink returns a sink pushing to the Pushgateway at gateway,
+// such as "http://localhost:9091", under the given job label.
+func NewPushgatewaySink(gateway string, job string) *PushgatewaySink {
+	return &PushgatewaySink{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		url:    strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job),
+	}
+}
+
+func (s *PushgatewaySink) Gauge(key string, value uint64) error {
+	s.current = append(s.current, promSample{prometheusName(key), value})
+	return nil
+}
+
+// CollectDuration records how long the pass took, pushed as
+// go_stats_collect_duration_seconds.
+func (s *PushgatewaySink) CollectDuration(d time.Duration) {
+	s.duration = d
+}
+
+func (s *PushgatewaySink) Flush() error {
+	s.last, s.current = s.current, s.last[:0]
+	s.lastDuration, s.duration = s.duration, 0
+	if s.PushEveryInterval {
+		return s.push()
+	}
+	return nil
+}
+
+// Close pushes the last complete collection pass.
+func (s *PushgatewaySink) Close() error {
+	return s.push()
+}
+
+func (s *PushgatewaySink) push() error {
+	if len(s.last) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	writeExposition(&body, s.last, s.lastDuration)
+	req, err := http.NewRequest(http.MethodPut, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gostats
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// droppingSink is a Sink that discards some metrics and reports how many,
+// output by the collector as cpu.SinkDropped.
+type droppingSink interface {
+	Dropped() uint64
+}
+
+// RateLimitedSink caps the rate of metrics handed to the sink it wraps with
+// a token bucket holding one second of budget, so bursts beyond it, for
+// example from high cardinality options, are dropped. The number of dropped
+// metrics is reported by Dropped and output as cpu.SinkDropped.
+type RateLimitedSink struct {
+	next      Sink
+	perSecond float64
+
+	tokens float64
+	last   time.Time
+
+	dropped atomic.Uint64
+}
+
+// RateLimit returns a sink passing at most perSecond metrics a second on to
+// next, for use with CollectTo.
+func RateLimit(perSecond int, next Sink) *RateLimitedSink {
+	return &RateLimitedSink{
+		next:      next,
+		perSecond: float64(perSecond),
+		tokens:    float64(perSecond),
+		last:      time.Now(),
+	}
+}
+
+// allow reports whether a metric fits the budget, taking a token for it.
+func (s *RateLimitedSink) allow() bool {
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.perSecond
+	if s.tokens > s.perSecond {
+		s.tokens = s.perSecond
+	}
+	s.last = now
+
+	if s.tokens < 1 {
+		s.dropped.Add(1)
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *RateLimitedSink) Gauge(key string, value uint64) error {
+	if !s.allow() {
+		return nil
+	}
+	return s.next.Gauge(key, value)
+}
+
+func (s *RateLimitedSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	if !s.allow() {
+		return nil
+	}
+	if next, ok := s.next.(TimestampedSink); ok {
+		return next.GaugeAt(key, value, ts)
+	}
+	return s.next.Gauge(key, value)
+}
+
+func (s *RateLimitedSink) Count(key string, delta uint64) error {
+	if !s.allow() {
+		return nil
+	}
+	if next, ok := s.next.(CounterSink); ok {
+		return next.Count(key, delta)
+	}
+	return s.next.Gauge(key, delta)
+}
+
+func (s *RateLimitedSink) Flush() error {
+	return s.next.Flush()
+}
+
+func (s *RateLimitedSink) CollectDuration(d time.Duration) {
+	if next, ok := s.next.(durationSink); ok {
+		next.CollectDuration(d)
+	}
+}
+
+func (s *RateLimitedSink) SetWriteDeadline(t time.Time) error {
+	if next, ok := s.next.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		return next.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (s *RateLimitedSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	if next, ok := s.next.(Drainer); ok {
+		return next.Drain(ctx)
+	}
+	return 0, 0, nil
+}
+
+func (s *RateLimitedSink) Close() error {
+	if next, ok := s.next.(io.Closer); ok {
+		return next.Close()
+	}
+	return nil
+}
+
+// Dropped returns the number of metrics dropped for exceeding the rate.
+func (s *RateLimitedSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,36 @@
+package gostats
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"time"
+)
+
+// RawMemStats, when set, receives the whole runtime.MemStats read by every
+// memory pass, not only the curated metrics, as a line of JSON holding the
+// pass timestamp under "ts" and the struct under "memstats":
+//
+//	{"ts":"2023-02-15T10:00:00Z","memstats":{"Alloc":1234,...}}
+//
+// It is meant for archiving every field for post-hoc debugging, separately
+// from the metrics sent to the sink. Encoding allocates on every pass.
+var RawMemStats io.Writer
+
+// rawMemStats is a line written to RawMemStats.
+type rawMemStats struct {
+	Time     time.Time         `json:"ts"`
+	MemStats *runtime.MemStats `json:"memstats"`
+}
+
+func (c *collector) writeRawMemStats(m *runtime.MemStats) {
+	b, err := json.Marshal(rawMemStats{c.passTime.UTC(), m})
+	if err != nil {
+		c.logger.Error("error encoding raw memory stats", "error", err)
+		return
+	}
+	b = append(b, '\n')
+	if _, err := c.rawMemStats.Write(b); err != nil {
+		c.logger.Error("error writing raw memory stats", "error", err)
+	}
+}
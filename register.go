@@ -0,0 +1,168 @@
+package gostats
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Structs registered with RegisterStruct, output by every collector.
+var (
+	registeredMu sync.Mutex
+	registered   []registeredStruct
+)
+
+// Constants set with SetConstant, in the order first set.
+var (
+	constantsMu   sync.Mutex
+	constantKeys  []string
+	constantValue = make(map[string]uint64)
+)
+
+// Gauges added with AddGauge, directly or through a Registrar, in the order
+// first added.
+var (
+	gaugesMu sync.Mutex
+	gauges   []customGauge
+)
+
+type customGauge struct {
+	key string
+	fn  func() uint64
+}
+
+// registeredStruct is a struct whose numeric fields are output every pass.
+type registeredStruct struct {
+	prefix string
+	value  reflect.Value
+	fields []int
+	keys   []string
+}
+
+// RegisterStruct makes the collector output the exported integer fields of
+// the struct v points to every interval, each under prefix.FieldName. Other
+// fields are skipped with a logged warning. Fields are read without any
+// synchronization by one collector or Handler at a time, so v must be safe
+// to read from their goroutines.
+func RegisterStruct(prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("RegisterStruct needs a pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	rs := registeredStruct{prefix: prefix, value: rv}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			rs.fields = append(rs.fields, i)
+			rs.keys = append(rs.keys, prefix+"."+f.Name)
+		default:
+			Logger.Warn("skipping non-integer struct field", "key", prefix+"."+f.Name, "type", f.Type.String())
+		}
+	}
+
+	registeredMu.Lock()
+	registered = append(registered, rs)
+	registeredMu.Unlock()
+	return nil
+}
+
+// SetConstant makes the collector output value under key every interval,
+// for values that rarely change but belong with the runtime statistics, such
+// as a replica index or a feature flag state. Setting the key again replaces
+// its value. Constants are handled like every other gauge on shutdown.
+func SetConstant(key string, value uint64) {
+	constantsMu.Lock()
+	if _, ok := constantValue[key]; !ok {
+		constantKeys = append(constantKeys, key)
+	}
+	constantValue[key] = value
+	constantsMu.Unlock()
+}
+
+// AddGauge makes the collector output the value fn returns under key every
+// interval, on the cadence and to the sink of the runtime statistics. Adding
+// the key again replaces its function. fn is called by one collector or
+// Handler at a time and must not block.
+func AddGauge(key string, fn func() uint64) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+	// Copied, the collection goroutine reading the slice unlocked.
+	added := append(make([]customGauge, 0, len(gauges)+1), gauges...)
+	for i := range added {
+		if added[i].key == key {
+			added[i].fn = fn
+			gauges = added
+			return
+		}
+	}
+	gauges = append(added, customGauge{key, fn})
+}
+
+// Registrar adds gauges under the sub-prefix of a scope, as returned by
+// Scope, so the subsystems of an application each contribute their metrics
+// under a name of their own, app.db.* and app.cache.* say.
+type Registrar struct {
+	prefix string
+}
+
+// Scope returns a registrar adding gauges under name.
+func Scope(name string) *Registrar {
+	return &Registrar{prefix: name}
+}
+
+// Scope returns a registrar adding gauges under name within the scope.
+func (r *Registrar) Scope(name string) *Registrar {
+	return &Registrar{prefix: r.prefix + "." + name}
+}
+
+// AddGauge adds a gauge under the scope, as AddGauge does.
+func (r *Registrar) AddGauge(name string, fn func() uint64) {
+	AddGauge(r.prefix+"."+name, fn)
+}
+
+func (c *collector) outputGauges() {
+	gaugesMu.Lock()
+	added := gauges
+	gaugesMu.Unlock()
+
+	for _, g := range added {
+		c.send(g.key, g.fn())
+	}
+}
+
+func (c *collector) outputConstants() {
+	constantsMu.Lock()
+	defer constantsMu.Unlock()
+	for _, key := range constantKeys {
+		c.send(key, constantValue[key])
+	}
+}
+
+func (c *collector) outputRegistered() {
+	registeredMu.Lock()
+	structs := registered
+	registeredMu.Unlock()
+
+	for _, rs := range structs {
+		for i, field := range rs.fields {
+			f := rs.value.Field(field)
+			if f.CanInt() {
+				if n := f.Int(); n > 0 {
+					c.send(rs.keys[i], uint64(n))
+				} else {
+					c.send(rs.keys[i], 0)
+				}
+			} else {
+				c.send(rs.keys[i], f.Uint())
+			}
+		}
+	}
+}
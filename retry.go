@@ -0,0 +1,204 @@
+package gostats
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// queueingSink is a Sink holding back some metrics to send them later and
+// reporting how many, output by the collector as cpu.SinkQueued.
+type queueingSink interface {
+	Queued() uint64
+}
+
+// RetryingSink stores the collection passes the sink it wraps fails to send
+// and forwards them once sending succeeds again, closing the gaps a brief
+// network blip leaves in the metric stream. Queued passes are retried,
+// oldest first, at the end of every pass. The queue is bounded by a number
+// of passes and an age, beyond which the oldest passes are dropped; the
+// number of queued passes is output as cpu.SinkQueued and of dropped ones as
+// cpu.SinkDropped. Metrics keep the timestamp of their collection when sent
+// late, for sinks that record one. A pass failing midway is resumed from the
+// metric that failed, so none is sent twice.
+type RetryingSink struct {
+	next      Sink
+	maxPasses int
+	maxAge    time.Duration
+
+	current retryPass
+	queue   []retryPass
+
+	queued  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// retryPass is a collection pass held for sending.
+type retryPass struct {
+	ts      time.Time
+	metrics []retryMetric
+
+	// Number of metrics already taken by the wrapped sink.
+	sent int
+}
+
+type retryMetric struct {
+	key     string
+	value   uint64
+	counter bool
+}
+
+// Retry returns a sink sending to next and keeping up to maxPasses
+// collection passes it fails to send, none older than maxAge, for use with
+// CollectTo. A zero maxAge doesn't limit the age.
+func Retry(next Sink, maxPasses int, maxAge time.Duration) *RetryingSink {
+	if maxPasses < 1 {
+		maxPasses = 1
+	}
+	return &RetryingSink{
+		next:      next,
+		maxPasses: maxPasses,
+		maxAge:    maxAge,
+	}
+}
+
+func (s *RetryingSink) Gauge(key string, value uint64) error {
+	return s.GaugeAt(key, value, time.Now())
+}
+
+func (s *RetryingSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	s.add(retryMetric{key: key, value: value}, ts)
+	return nil
+}
+
+func (s *RetryingSink) Count(key string, delta uint64) error {
+	s.add(retryMetric{key: key, value: delta, counter: true}, time.Now())
+	return nil
+}
+
+func (s *RetryingSink) add(m retryMetric, ts time.Time) {
+	if len(s.current.metrics) == 0 {
+		s.current.ts = ts
+	}
+	s.current.metrics = append(s.current.metrics, m)
+}
+
+// Flush queues the pass and sends the queue, keeping what fails.
+func (s *RetryingSink) Flush() error {
+	if len(s.current.metrics) > 0 {
+		s.queue = append(s.queue, s.current)
+		s.current = retryPass{}
+	}
+	s.expire()
+	_, err := s.sendQueue()
+	return err
+}
+
+// expire drops the passes beyond the age and size limits, oldest first.
+func (s *RetryingSink) expire() {
+	drop := 0
+	if len(s.queue) > s.maxPasses {
+		drop = len(s.queue) - s.maxPasses
+	}
+	if s.maxAge > 0 {
+		for drop < len(s.queue) && time.Since(s.queue[drop].ts) > s.maxAge {
+			drop++
+		}
+	}
+	if drop > 0 {
+		s.dropped.Add(uint64(drop))
+		s.queue = append(s.queue[:0], s.queue[drop:]...)
+	}
+}
+
+// sendQueue sends the queued passes in order until one fails, returning the
+// number of metrics sent.
+func (s *RetryingSink) sendQueue() (int, error) {
+	defer func() { s.queued.Store(uint64(len(s.queue))) }()
+
+	sent := 0
+	for len(s.queue) > 0 {
+		p := &s.queue[0]
+		before := p.sent
+		err := s.send(p)
+		sent += p.sent - before
+		if err != nil {
+			return sent, err
+		}
+		s.queue = append(s.queue[:0], s.queue[1:]...)
+	}
+	return sent, nil
+}
+
+// send sends the metrics of p from the first not yet taken, then flushes.
+func (s *RetryingSink) send(p *retryPass) error {
+	for _, m := range p.metrics[p.sent:] {
+		var err error
+		if cs, ok := s.next.(CounterSink); ok && m.counter {
+			err = cs.Count(m.key, m.value)
+		} else if ts, ok := s.next.(TimestampedSink); ok {
+			err = ts.GaugeAt(m.key, m.value, p.ts)
+		} else {
+			err = s.next.Gauge(m.key, m.value)
+		}
+		if err != nil {
+			return err
+		}
+		p.sent++
+	}
+	return s.next.Flush()
+}
+
+// Queued returns the number of passes waiting to be sent.
+func (s *RetryingSink) Queued() uint64 {
+	return s.queued.Load()
+}
+
+// Dropped returns the number of passes dropped for the queue limits.
+func (s *RetryingSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Drain makes a last attempt at sending the queued passes, dropping them if
+// it fails, then drains the wrapped sink if it buffers too.
+func (s *RetryingSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	flushed, err = s.sendQueue()
+	if err != nil {
+		for _, p := range s.queue {
+			dropped += len(p.metrics) - p.sent
+		}
+		s.dropped.Add(uint64(len(s.queue)))
+		s.queue = s.queue[:0]
+		s.queued.Store(0)
+		return flushed, dropped, err
+	}
+	if next, ok := s.next.(Drainer); ok {
+		f, d, err := next.Drain(ctx)
+		return flushed + f, d, err
+	}
+	return flushed, 0, nil
+}
+
+func (s *RetryingSink) CollectDuration(d time.Duration) {
+	if next, ok := s.next.(durationSink); ok {
+		next.CollectDuration(d)
+	}
+}
+
+func (s *RetryingSink) SetWriteDeadline(t time.Time) error {
+	if next, ok := s.next.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		return next.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (s *RetryingSink) Close() error {
+	if next, ok := s.next.(io.Closer); ok {
+		return next.Close()
+	}
+	return nil
+}
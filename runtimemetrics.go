@@ -0,0 +1,463 @@
+package gostats
+
+import (
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// EnableAllRuntimeMetrics makes the collector emit every metric exposed by
+// runtime/metrics under a "runtime." bucket. This is high cardinality and
+// meant for exhaustive debugging. Float metrics measured in seconds are
+// scaled to nanoseconds, histograms are summarized as a few percentiles.
+var EnableAllRuntimeMetrics = false
+
+// HistogramBuckets selects runtime/metrics histograms to be output bucket by
+// bucket, mapping the metric name to the upper bounds of the buckets in the
+// unit of the metric. Every bound is sent as the cumulative count of samples
+// not above it, Prometheus style, along with a final "le_inf" total:
+//
+//	HistogramBuckets = map[string][]float64{
+//		"/gc/pauses:seconds": {0.0001, 0.001, 0.01},
+//	}
+//
+// produces runtime.gc.pauses_seconds.le_0_0001s and so on. Each bound adds a
+// gauge, so keep the selection small.
+var HistogramBuckets map[string][]float64
+
+// EnableGCCPUMetrics makes the collector output the cumulative CPU time spent
+// on garbage collection from runtime/metrics, split between background work
+// and assists stealing time from application goroutines, as counters whose
+// increase over the interval is output under key.delta whatever DeltaMode,
+// along with mem.gc.cpu.AssistSharePPM, the share of the marking done by
+// assists over the interval. The metrics are skipped on Go versions that
+// don't expose them (before 1.20).
+var EnableGCCPUMetrics = false
+
+// EnableSchedLatency makes the collector output the 50th and 99th percentile
+// of the time goroutines spent runnable before running, in nanoseconds, as
+// cpu.SchedLatencyP50 and cpu.SchedLatencyP99. High values indicate the
+// scheduler is saturated. Skipped on Go versions before 1.17, which don't
+// expose it.
+var EnableSchedLatency = false
+
+// SchedStats makes the collector output whether goroutines are starving for
+// CPU: cpu.GOMAXPROCS, cpu.SchedLatency, the 99th percentile of the time
+// goroutines spent runnable before running in nanoseconds, and
+// cpu.GCCPUFraction, the share of the available CPU used by the GC since the
+// program started in millionths, with the memory statistics. Off by default
+// so existing dashboards don't gain metrics.
+var SchedStats = false
+
+// EnableGoroutinesCreated makes the collector output the cumulative number
+// of goroutines created as the cpu.GoroutinesCreated counter. A rising
+// creation rate with a stable cpu.NumGoroutine reveals goroutine churn
+// rather than a leak. Skipped on Go versions before 1.26, which don't
+// expose it.
+var EnableGoroutinesCreated = false
+
+// gcCPUMetrics maps the runtime/metrics GC CPU classes to their buckets.
+var gcCPUMetrics = []runtimeMetric{
+	{"/cpu/classes/gc/mark/assist:cpu-seconds", "mem.gc.cpu.MarkAssistNs"},
+	{"/cpu/classes/gc/mark/dedicated:cpu-seconds", "mem.gc.cpu.MarkDedicatedNs"},
+	{"/cpu/classes/gc/mark/idle:cpu-seconds", "mem.gc.cpu.MarkIdleNs"},
+	{"/cpu/classes/gc/pause:cpu-seconds", "mem.gc.cpu.PauseNs"},
+	{"/cpu/classes/gc/total:cpu-seconds", "mem.gc.cpu.TotalNs"},
+}
+
+// finalizerMetrics maps the runtime/metrics finalizer and cleanup counts to
+// their buckets. They were added in Go 1.25 and are skipped on older versions.
+var finalizerMetrics = []runtimeMetric{
+	{"/gc/finalizers/queued:finalizers", "mem.gc.finalizer.Queued"},
+	{"/gc/finalizers/executed:finalizers", "mem.gc.finalizer.Executed"},
+	{"/gc/cleanups/queued:cleanups", "mem.gc.finalizer.CleanupsQueued"},
+	{"/gc/cleanups/executed:cleanups", "mem.gc.finalizer.CleanupsExecuted"},
+}
+
+// runtimeMetric names the bucket a runtime/metrics metric is output under.
+type runtimeMetric struct {
+	name   string
+	bucket string
+}
+
+// runtimeSet is a fixed set of runtime/metrics metrics, read together.
+type runtimeSet struct {
+	samples []metrics.Sample
+	buckets []string
+
+	// Values of the previous read and changes since, for the sets output
+	// as counters.
+	prev   []uint64
+	deltas []uint64
+}
+
+// newRuntimeSet returns the set of the given metrics supported by the
+// running Go version.
+func newRuntimeSet(list []runtimeMetric) *runtimeSet {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+
+	rs := &runtimeSet{}
+	for _, m := range list {
+		if supported[m.name] {
+			rs.samples = append(rs.samples, metrics.Sample{Name: m.name})
+			rs.buckets = append(rs.buckets, m.bucket)
+		}
+	}
+	return rs
+}
+
+// output reads and sends every metric in the set.
+func (rs *runtimeSet) output(c *collector) {
+	if len(rs.samples) == 0 {
+		return
+	}
+	metrics.Read(rs.samples)
+	for i := range rs.samples {
+		if v, ok := rs.value(i); ok {
+			c.send(rs.buckets[i], v)
+		}
+	}
+}
+
+// outputCounters reads and sends every metric in the set as a counter
+// according to mode, keeping the values for the deltas of the next pass.
+func (rs *runtimeSet) outputCounters(c *collector, mode CounterMode) {
+	if len(rs.samples) == 0 {
+		return
+	}
+	metrics.Read(rs.samples)
+	// The first read has nothing to compare with, its deltas are zero.
+	first := rs.prev == nil
+	if first {
+		rs.prev = make([]uint64, len(rs.samples))
+		rs.deltas = make([]uint64, len(rs.samples))
+	}
+	for i := range rs.samples {
+		v, ok := rs.value(i)
+		if !ok {
+			continue
+		}
+		if first {
+			rs.prev[i] = v
+		}
+		c.sendCounterMode(rs.buckets[i], v, rs.prev[i], mode)
+		rs.deltas[i] = sub(v, rs.prev[i])
+		rs.prev[i] = v
+	}
+}
+
+// value returns the last read value of the i-th metric, seconds scaled to
+// nanoseconds, if it is a number.
+func (rs *runtimeSet) value(i int) (uint64, bool) {
+	s := rs.samples[i]
+	switch s.Value.Kind() {
+	case metrics.KindUint64:
+		return s.Value.Uint64(), true
+	case metrics.KindFloat64:
+		return floatToUint(s.Value.Float64() * runtimeMetricScale(s.Name)), true
+	}
+	return 0, false
+}
+
+// uint64 returns the last read value of the named metric, if in the set.
+func (rs *runtimeSet) uint64(name string) (uint64, bool) {
+	for _, s := range rs.samples {
+		if s.Name == name && s.Value.Kind() == metrics.KindUint64 {
+			return s.Value.Uint64(), true
+		}
+	}
+	return 0, false
+}
+
+// delta returns the change of the named metric over the last read, if in
+// the set.
+func (rs *runtimeSet) delta(name string) (uint64, bool) {
+	for i, s := range rs.samples {
+		if s.Name == name && rs.deltas != nil {
+			return rs.deltas[i], true
+		}
+	}
+	return 0, false
+}
+
+// outputGCCPUStats outputs the CPU time of the GC classes as counters, and
+// the share of the marking done by assists over the interval: high, the GC
+// cost falls on application goroutines rather than background workers. The
+// increases of the classes are output whatever the delta mode, the
+// cumulative times being of little use on their own.
+func (c *collector) outputGCCPUStats() {
+	if c.gcCPU == nil {
+		c.gcCPU = newRuntimeSet(gcCPUMetrics)
+	}
+	rs := c.gcCPU
+	mode := c.deltaMode
+	if mode == AbsoluteOnly {
+		mode = AbsoluteAndDelta
+	}
+	rs.outputCounters(c, mode)
+
+	assist, ok := rs.delta(gcCPUMetrics[0].name)
+	dedicated, ok2 := rs.delta(gcCPUMetrics[1].name)
+	idle, ok3 := rs.delta(gcCPUMetrics[2].name)
+	if ok && ok2 && ok3 {
+		c.sendDelta("mem.gc.cpu.AssistSharePPM", ppm(assist, assist+dedicated+idle))
+	}
+}
+
+// outputFinalizerStats outputs the finalizer and cleanup counts along with
+// their backlog, queued but not yet run, a pileup of which retains memory.
+func (c *collector) outputFinalizerStats() {
+	if c.finalizers == nil {
+		c.finalizers = newRuntimeSet(finalizerMetrics)
+	}
+	rs := c.finalizers
+	rs.output(c)
+
+	backlog := func(bucket string, queued string, executed string) {
+		q, ok := rs.uint64(queued)
+		e, ok2 := rs.uint64(executed)
+		if ok && ok2 {
+			c.send(bucket, sub(q, e))
+		}
+	}
+	backlog("mem.gc.finalizer.Backlog", finalizerMetrics[0].name, finalizerMetrics[1].name)
+	backlog("mem.gc.finalizer.CleanupsBacklog", finalizerMetrics[2].name, finalizerMetrics[3].name)
+}
+
+// schedLatency reads the scheduling latency histogram.
+type schedLatency struct {
+	samples []metrics.Sample
+}
+
+// outputSchedLatency outputs the scheduling latency percentiles of
+// EnableSchedLatency and SchedStats from a single read of the histogram.
+func (c *collector) outputSchedLatency() {
+	if c.schedLatency == nil {
+		c.schedLatency = &schedLatency{
+			samples: []metrics.Sample{{Name: "/sched/latencies:seconds"}},
+		}
+	}
+	s := c.schedLatency.samples
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return
+	}
+
+	h := s[0].Value.Float64Histogram()
+	if c.enableSchedLatency {
+		c.send("cpu.SchedLatencyP50", floatToUint(histogramQuantile(h, 0.50)*1e9))
+		c.send("cpu.SchedLatencyP99", floatToUint(histogramQuantile(h, 0.99)*1e9))
+	}
+	if c.schedStats {
+		c.send("cpu.SchedLatency", floatToUint(histogramQuantile(h, 0.99)*1e9))
+	}
+}
+
+// Percentiles reported for runtime/metrics histograms.
+var histogramPercentiles = []struct {
+	suffix string
+	q      float64
+}{
+	{"p50", 0.50},
+	{"p90", 0.90},
+	{"p99", 0.99},
+}
+
+// runtimeMetrics holds the samples read on every pass, allocated once.
+type runtimeMetrics struct {
+	samples []metrics.Sample
+	buckets []string
+
+	// Buckets of the percentiles of every histogram.
+	percentiles [][]string
+}
+
+func newRuntimeMetrics() *runtimeMetrics {
+	descs := metrics.All()
+	rm := &runtimeMetrics{
+		samples:     make([]metrics.Sample, len(descs)),
+		buckets:     make([]string, len(descs)),
+		percentiles: make([][]string, len(descs)),
+	}
+	for i, d := range descs {
+		rm.samples[i].Name = d.Name
+		rm.buckets[i] = runtimeMetricBucket(d.Name)
+		if d.Kind == metrics.KindFloat64Histogram {
+			for _, p := range histogramPercentiles {
+				rm.percentiles[i] = append(rm.percentiles[i], rm.buckets[i]+"."+p.suffix)
+			}
+		}
+	}
+	return rm
+}
+
+func (c *collector) outputRuntimeMetrics() {
+	if c.runtimeMetrics == nil {
+		c.runtimeMetrics = newRuntimeMetrics()
+	}
+	rm := c.runtimeMetrics
+	metrics.Read(rm.samples)
+
+	for i, s := range rm.samples {
+		bucket := rm.buckets[i]
+		scale := runtimeMetricScale(s.Name)
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			c.send(bucket, s.Value.Uint64())
+		case metrics.KindFloat64:
+			c.send(bucket, floatToUint(s.Value.Float64()*scale))
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			for j, p := range histogramPercentiles {
+				c.send(rm.percentiles[i][j], floatToUint(histogramQuantile(h, p.q)*scale))
+			}
+		}
+	}
+}
+
+// bucketedHistograms holds the samples of the HistogramBuckets metrics.
+type bucketedHistograms struct {
+	samples []metrics.Sample
+	bounds  [][]float64
+	keys    [][]string
+}
+
+func newBucketedHistograms(selection map[string][]float64) *bucketedHistograms {
+	bh := &bucketedHistograms{}
+	for name, bounds := range selection {
+		unit := ""
+		if runtimeMetricScale(name) != 1 {
+			unit = "s"
+		}
+		keys := make([]string, 0, len(bounds)+1)
+		for _, b := range bounds {
+			le := strings.ReplaceAll(strconv.FormatFloat(b, 'f', -1, 64), ".", "_")
+			keys = append(keys, runtimeMetricBucket(name)+".le_"+le+unit)
+		}
+		keys = append(keys, runtimeMetricBucket(name)+".le_inf")
+
+		bh.samples = append(bh.samples, metrics.Sample{Name: name})
+		bh.bounds = append(bh.bounds, bounds)
+		bh.keys = append(bh.keys, keys)
+	}
+	return bh
+}
+
+func (c *collector) outputHistogramBuckets() {
+	if c.histogramBuckets == nil {
+		c.histogramBuckets = newBucketedHistograms(c.histogramSelection)
+	}
+	bh := c.histogramBuckets
+	metrics.Read(bh.samples)
+
+	for i, s := range bh.samples {
+		if s.Value.Kind() != metrics.KindFloat64Histogram {
+			continue
+		}
+		h := s.Value.Float64Histogram()
+		for j, bound := range bh.bounds[i] {
+			c.send(bh.keys[i][j], histogramCountBelow(h, bound))
+		}
+		c.send(bh.keys[i][len(bh.bounds[i])], histogramCountBelow(h, math.Inf(1)))
+	}
+}
+
+// histogramCountBelow returns the number of samples in buckets of h whose
+// upper bound doesn't exceed bound.
+func histogramCountBelow(h *metrics.Float64Histogram, bound float64) uint64 {
+	var n uint64
+	for i, count := range h.Counts {
+		if h.Buckets[i+1] > bound {
+			break
+		}
+		n += count
+	}
+	return n
+}
+
+// runtimeMetricBucket converts a runtime/metrics name such as
+// "/gc/heap/allocs:bytes" to a bucket like "runtime.gc.heap.allocs_bytes".
+func runtimeMetricBucket(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	b := []byte(name)
+	for i, ch := range b {
+		switch {
+		case ch == '/':
+			b[i] = '.'
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '_':
+		default:
+			b[i] = '_'
+		}
+	}
+	return "runtime." + string(b)
+}
+
+// runtimeMetricScale returns the factor float values of the named metric are
+// multiplied by before being truncated to an integer.
+func runtimeMetricScale(name string) float64 {
+	if i := strings.LastIndexByte(name, ':'); i >= 0 && strings.Contains(name[i:], "seconds") {
+		return 1e9
+	}
+	return 1
+}
+
+// histogramQuantile estimates the q-th quantile of h as the upper bound of
+// the bucket containing it.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cum uint64
+	for i, n := range h.Counts {
+		cum += n
+		if cum < rank {
+			continue
+		}
+		if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+			return upper
+		}
+		if lower := h.Buckets[i]; !math.IsInf(lower, -1) {
+			return lower
+		}
+		return 0
+	}
+	return 0
+}
+
+// floatToUint converts f to an integer gauge value, clamping at zero.
+func floatToUint(f float64) uint64 {
+	if f <= 0 || math.IsNaN(f) {
+		return 0
+	}
+	if f >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(f)
+}
+
+func (c *collector) outputGoroutinesCreated() {
+	created, ok := c.readRuntimeMetric("/sched/goroutines-created:goroutines")
+	if !ok {
+		return
+	}
+	// The first pass has nothing to compare with, its delta is zero.
+	prev := c.prevGoroutinesCreated
+	if c.cpuPasses == 1 {
+		prev = created
+	}
+	c.sendCounter("cpu.GoroutinesCreated", created, prev)
+	c.prevGoroutinesCreated = created
+}
@@ -0,0 +1,51 @@
+package gostats
+
+// Sanitize, when set, rewrites every composed key, after the prefix or
+// template is applied, to remove characters the backend rejects, such as
+// those of a user supplied prefix. SanitizePrometheus and SanitizeGraphite
+// suit those backends, SanitizeNone leaves keys unchanged. Each key is
+// sanitized once and cached.
+var Sanitize func(key string) string
+
+// SanitizeNone returns key unchanged.
+func SanitizeNone(key string) string {
+	return key
+}
+
+// SanitizePrometheus replaces every character not allowed in a Prometheus
+// metric name, including dots, with an underscore.
+func SanitizePrometheus(key string) string {
+	return replaceInvalid(key, func(i int, ch byte) bool {
+		return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == ':' ||
+			ch >= '0' && ch <= '9' && i > 0
+	})
+}
+
+// SanitizeGraphite replaces every character other than letters, digits,
+// dots, dashes and underscores with an underscore, keeping the dotted
+// hierarchy.
+func SanitizeGraphite(key string) string {
+	return replaceInvalid(key, func(i int, ch byte) bool {
+		return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+			ch == '.' || ch == '-' || ch == '_'
+	})
+}
+
+// replaceInvalid replaces the bytes of s that valid rejects with an
+// underscore, returning s itself if all are valid.
+func replaceInvalid(s string, valid func(i int, ch byte) bool) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if valid(i, s[i]) {
+			continue
+		}
+		if b == nil {
+			b = []byte(s)
+		}
+		b[i] = '_'
+	}
+	if b == nil {
+		return s
+	}
+	return string(b)
+}
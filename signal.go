@@ -0,0 +1,32 @@
+package gostats
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals stops the running collector, with its final shutdown output,
+// when one of signals arrives, SIGINT and SIGTERM if none are given. The
+// signal is then delivered again with its default handling restored, so the
+// program still terminates as it would have without the handler. Programs
+// handling these signals themselves should call Stop from their own handler
+// instead.
+func HandleSignals(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		Stop()
+
+		signal.Stop(ch)
+		signal.Reset(signals...)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(sig)
+		}
+	}()
+}
@@ -0,0 +1,524 @@
+package gostats
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FormatValue, when set, formats the value of every gauge written to statsd,
+// for example to send byte counts as fractional megabytes. Values are sent
+// as plain decimal integers otherwise.
+var FormatValue func(key string, value uint64) string
+
+// OverflowPolicy selects how values above MaxStatsdValue are written to
+// statsd, for servers parsing values into floats or signed integers that
+// fail on the largest gauges, such as nanosecond timestamps.
+type OverflowPolicy int
+
+const (
+	// OverflowDecimal writes them as plain decimal integers like any other.
+	OverflowDecimal OverflowPolicy = iota
+
+	// OverflowScientific writes them in scientific notation, 1.6764e+18
+	// say, losing the digits beyond float64 precision.
+	OverflowScientific
+
+	// OverflowClamp writes MaxStatsdValue instead, with a warning logged
+	// the first time a key is clamped.
+	OverflowClamp
+)
+
+// LargeValues is how values above MaxStatsdValue are written. FormatValue
+// takes precedence when set.
+var LargeValues = OverflowDecimal
+
+// MaxStatsdValue is the largest value written as is under LargeValues,
+// defaults to 2^53, the largest integer a float64 holds exactly.
+var MaxStatsdValue uint64 = 1 << 53
+
+// WriteBufferBytes, when positive, sets the socket send buffer size of the
+// statsd connection, reducing kernel level drops when many gauges are sent
+// per interval.
+var WriteBufferBytes = 0
+
+// SampleRates sets the statsd sample rate of individual metrics, keyed by the
+// full key as sent. A metric with a rate below 1 is only sent with that
+// probability, tagged with the rate so the server can scale it back up.
+// Metrics not listed are sent at SampleRate.
+var SampleRates map[string]float32
+
+// SampleRate is the statsd sample rate of the metrics SampleRates doesn't
+// list, in (0, 1]. Lowering it thins out the traffic of short intervals or
+// many instances. The final output at shutdown is always sent at full rate.
+var SampleRate float32 = 1
+
+// fullRateSink is a Sink that samples metrics, told when to send every one
+// regardless, for the final output at shutdown to land.
+type fullRateSink interface {
+	SetFullRate(full bool)
+}
+
+// AlwaysSend lists the full keys, as sent, of critical metrics never to be
+// sampled, such as a heartbeat or the RSS. They are sent on every pass
+// without a rate, even if SampleRates or SampleRate gives them one.
+var AlwaysSend map[string]bool
+
+// Transport is the network statsd is sent over, "udp" or "tcp". TCP
+// reports failed sends, which makes the collector reconnect, and sends the
+// metrics as newline terminated lines, for relays only accepting TCP. It is
+// the default of the collectors whose Config doesn't set one.
+var Transport = "udp"
+
+// TLSConfig, when set, makes the collector connect to statsd over TLS on TCP
+// whatever the Transport, for ingestion endpoints that require it. Server name
+// verification and custom CAs are set through the config as usual; the
+// server name defaults to the endpoint host. Metrics are sent as newline
+// terminated lines.
+var TLSConfig *tls.Config
+
+// Tags are attached to every metric sent to statsd, serialized according to
+// TagStyle, such as env:prod in the DogStatsD line key:1|g|#env:prod. Lines
+// are unchanged without any. Names and values can't contain the separators
+// of the tag styles, commas, pipes, hashes, semicolons or newlines, nor can
+// names contain colons or equal signs.
+var Tags map[string]string
+
+// tagSeparators are the characters separating tags in one style or another.
+const tagSeparators = ",|#;\n"
+
+// TagStyle selects how Tags are serialized, statsd compatible servers
+// disagreeing on the syntax. Defaults to TagsDogStatsD.
+var TagStyle = TagsDogStatsD
+
+// UnitTags attaches the unit of every built-in metric, as listed by Describe,
+// as a unit tag such as unit:bytes when TagStyle is TagsDogStatsD, for
+// Datadog to pick up. Delta keys carry the unit of their metric. Metrics of
+// no known unit, including those renamed by Transform, are sent without, as
+// is everything in the other tag styles.
+var UnitTags = false
+
+// UseNativeStatsdTypes sends the built-in metrics to statsd with the type
+// their kind in Describe calls for, so servers accepting the extended syntax
+// such as Telegraf or veneur aggregate each correctly: the deltas DeltaMode
+// outputs of counters as counters, timers such as mem.gc.Pause as timers in
+// fractional milliseconds, and everything else as gauges. Metrics are all
+// sent as gauges otherwise, but for the interval counters such as
+// mem.gc.PauseCount. The counters and timers are left out of the final
+// output at shutdown, a resent delta being counted twice and a zero timer
+// skewing the percentiles.
+var UseNativeStatsdTypes = false
+
+// TagFormat is a statsd tag syntax.
+type TagFormat int
+
+const (
+	// TagsDogStatsD appends the tags to the line: key:1|g|#k:v,k2:v2
+	TagsDogStatsD TagFormat = iota
+
+	// TagsLibrato appends the tags to the name: key#k=v,k2=v2:1|g
+	TagsLibrato
+
+	// TagsGraphite appends the tags to the name: key;k=v;k2=v2:1|g
+	TagsGraphite
+)
+
+// formatTags serializes tags in the given style, sorted by name, returning
+// what goes after the metric name and what goes at the end of the line.
+func formatTags(tags map[string]string, style TagFormat) (name string, line string) {
+	if len(tags) == 0 {
+		return "", ""
+	}
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, k := range names {
+		switch style {
+		case TagsLibrato:
+			if i == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(k + "=" + tags[k])
+		case TagsGraphite:
+			b.WriteString(";" + k + "=" + tags[k])
+		default:
+			if i == 0 {
+				b.WriteString("|#")
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(k + ":" + tags[k])
+		}
+	}
+	if style == TagsDogStatsD {
+		return "", b.String()
+	}
+	return b.String(), ""
+}
+
+// Endpoints lists fallback statsd endpoints, tried in order after the one
+// given to Collect or Run. The first reachable endpoint is used, and the
+// collector fails over to the next one when sending or redialing fails,
+// wrapping around the list. UDP gives little delivery feedback, only
+// resolution failures and refused datagrams reported by the host, so an
+// endpoint that silently drops datagrams is never failed over from; TCP and
+// TLS connections report every failed send, and are redialed on failure
+// even without fallback endpoints.
+var Endpoints []string
+
+// Sink receives the statistics of every collection pass.
+type Sink interface {
+	// Gauge outputs the value of a single metric.
+	Gauge(key string, value uint64) error
+
+	// Flush is called at the end of every collection pass.
+	Flush() error
+}
+
+// TimestampedSink is a Sink that can record when a metric was collected.
+// Every metric of a collection pass is given the same timestamp, taken at the
+// start of the pass.
+type TimestampedSink interface {
+	Sink
+
+	// GaugeAt outputs the value of a single metric collected at ts.
+	GaugeAt(key string, value uint64, ts time.Time) error
+}
+
+// CounterSink is a Sink that distinguishes counters, incremented by the
+// value sent, from gauges. Counters are sent as gauges of the increment to
+// sinks that don't implement it.
+type CounterSink interface {
+	Sink
+
+	// Count increments the counter key by delta.
+	Count(key string, delta uint64) error
+}
+
+// statsdSink writes every gauge as a statsd datagram.
+type statsdSink struct {
+	conn        net.Conn
+	formatValue func(key string, value uint64) string
+	sampleRates map[string]float32
+	sampleRate  float32
+	alwaysSend  map[string]bool
+	fullRate    bool
+
+	// Writing of values above maxValue, and the keys clamped so far.
+	largeValues OverflowPolicy
+	maxValue    uint64
+	clamped     map[string]bool
+
+	// Network the endpoints are dialed over, and whether it is a stream
+	// one, every metric then being terminated with a newline.
+	transport string
+	stream    bool
+
+	// Serialized tags, following the name and ending the line, and the
+	// line endings of the keys with a unit tag, nil without UnitTags.
+	nameTags string
+	lineTags string
+	unitTags map[string]string
+
+	// Statsd type of the keys not sent as gauges, nil without
+	// UseNativeStatsdTypes.
+	types map[string]string
+
+	// Endpoints to fail over between, the index of the connected one and
+	// the number of failovers.
+	endpoints  []string
+	active     int
+	reconnects atomic.Uint64
+
+	// Scratch buffer the datagrams are formatted into.
+	buf []byte
+}
+
+func newStatsdSink(conn net.Conn, transport string) *statsdSink {
+	s := &statsdSink{
+		conn:        conn,
+		formatValue: FormatValue,
+		sampleRates: SampleRates,
+		sampleRate:  SampleRate,
+		alwaysSend:  AlwaysSend,
+		largeValues: LargeValues,
+		maxValue:    MaxStatsdValue,
+		transport:   transport,
+		stream:      TLSConfig != nil || transport != "udp",
+	}
+	s.nameTags, s.lineTags = formatTags(Tags, TagStyle)
+	if UnitTags && TagStyle == TagsDogStatsD {
+		s.unitTags = make(map[string]string)
+	}
+	if UseNativeStatsdTypes {
+		s.types = make(map[string]string)
+	}
+	return s
+}
+
+// dialStatsd connects over transport to the first reachable of endpoint and
+// the fallback Endpoints, returning a sink that fails over between them.
+func dialStatsd(endpoint string, transport string) (*statsdSink, error) {
+	s := newStatsdSink(nil, transport)
+	s.endpoints = append([]string{endpoint}, Endpoints...)
+	s.active = len(s.endpoints) - 1
+	if err := s.failover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// failover connects to the endpoint following the active one, trying every
+// endpoint in turn and returning the last error if none is reachable.
+func (s *statsdSink) failover() error {
+	var err error
+	for range s.endpoints {
+		s.active = (s.active + 1) % len(s.endpoints)
+		var conn net.Conn
+		if conn, err = dial(s.endpoints[s.active], s.transport); err == nil {
+			if s.conn != nil {
+				s.conn.Close()
+			}
+			s.conn = conn
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *statsdSink) Gauge(key string, value uint64) error {
+	if kind, ok := s.types[key]; ok {
+		return s.write(key, value, kind)
+	}
+	return s.write(key, value, "|g")
+}
+
+func (s *statsdSink) write(key string, value uint64, kind string) error {
+	rate, sampled := s.sampleRates[key]
+	if !sampled {
+		rate, sampled = s.sampleRate, true
+	}
+	if sampled && (rate >= 1 || s.alwaysSend[key] || s.fullRate) {
+		sampled = false
+	}
+	if sampled && rand.Float32() >= rate {
+		return nil
+	}
+
+	buf := append(s.buf[:0], key...)
+	buf = append(buf, s.nameTags...)
+	buf = append(buf, ':')
+	if kind == "|ms" {
+		buf = strconv.AppendFloat(buf, float64(value)/1e6, 'f', -1, 64)
+	} else {
+		buf = s.appendValue(buf, key, value)
+	}
+	buf = append(buf, kind...)
+	if sampled {
+		buf = append(buf, "|@"...)
+		buf = strconv.AppendFloat(buf, float64(rate), 'g', -1, 32)
+	}
+	if tags, ok := s.unitTags[key]; ok {
+		buf = append(buf, tags...)
+	} else {
+		buf = append(buf, s.lineTags...)
+	}
+	if s.stream {
+		buf = append(buf, '\n')
+	}
+	s.buf = buf
+
+	// A stream connection is redialed even without another endpoint to fail
+	// over to, having most likely been closed by the server.
+	n, err := s.conn.Write(buf)
+	if err != nil && (len(s.endpoints) > 1 || len(s.endpoints) == 1 && s.stream) {
+		Logger.Warn("error sending to statsd, reconnecting", "endpoint", s.endpoints[s.active], "error", err)
+		if ferr := s.failover(); ferr != nil {
+			return err
+		}
+		s.reconnects.Add(1)
+		n, err = s.conn.Write(buf)
+	}
+	if err != nil {
+		return err
+	} else if n != len(buf) {
+		return fmt.Errorf("short send: %d < %d", n, len(buf))
+	}
+	return nil
+}
+
+// SetFullRate makes every metric be sent without sampling while full.
+func (s *statsdSink) SetFullRate(full bool) {
+	s.fullRate = full
+}
+
+// SetUnit records the unit tag of key, with UnitTags.
+func (s *statsdSink) SetUnit(key string, unit string) {
+	if s.unitTags == nil {
+		return
+	}
+	if s.lineTags == "" {
+		s.unitTags[key] = "|#unit:" + unit
+	} else {
+		s.unitTags[key] = s.lineTags + ",unit:" + unit
+	}
+}
+
+// Typed reports whether key is sent with a statsd type other than gauge.
+func (s *statsdSink) Typed(key string) bool {
+	_, ok := s.types[key]
+	return ok
+}
+
+// SetKind records the statsd type of key, with UseNativeStatsdTypes.
+func (s *statsdSink) SetKind(key string, kind MetricKind) {
+	if s.types == nil {
+		return
+	}
+	switch kind {
+	case KindCounter:
+		s.types[key] = "|c"
+	case KindTimer:
+		s.types[key] = "|ms"
+	}
+}
+
+// appendValue formats value following FormatValue and LargeValues.
+func (s *statsdSink) appendValue(buf []byte, key string, value uint64) []byte {
+	switch {
+	case s.formatValue != nil:
+		return append(buf, s.formatValue(key, value)...)
+	case value <= s.maxValue || s.largeValues == OverflowDecimal:
+		return strconv.AppendUint(buf, value, 10)
+	case s.largeValues == OverflowScientific:
+		return strconv.AppendFloat(buf, float64(value), 'e', -1, 64)
+	}
+
+	if !s.clamped[key] {
+		if s.clamped == nil {
+			s.clamped = make(map[string]bool)
+		}
+		s.clamped[key] = true
+		Logger.Warn("clamping value too large for statsd", "key", key, "value", value, "max", s.maxValue)
+	}
+	return strconv.AppendUint(buf, s.maxValue, 10)
+}
+
+func (s *statsdSink) Count(key string, delta uint64) error {
+	return s.write(key, delta, "|c")
+}
+
+// Reconnects returns the number of failovers to another endpoint, or of
+// redials of a single TCP or TLS one.
+func (s *statsdSink) Reconnects() uint64 {
+	return s.reconnects.Load()
+}
+
+func (s *statsdSink) Flush() error {
+	return nil
+}
+
+func (s *statsdSink) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+// dial connects to the statsd endpoint, retrying up to DialRetries times and
+// returning the last error if every attempt failed.
+func dial(endpoint string, transport string) (net.Conn, error) {
+	endpoint, err := normalizeEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := transport
+	if TLSConfig != nil {
+		protocol = "tls"
+	}
+
+	backoff := DialBackoff
+	for attempt := 0; ; attempt++ {
+		var conn net.Conn
+		if TLSConfig != nil {
+			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", endpoint, TLSConfig)
+		} else {
+			conn, err = net.DialTimeout(transport, endpoint, 2*time.Second)
+		}
+		if err == nil {
+			Logger.Info("connected to statsd", "endpoint", endpoint, "protocol", protocol)
+			setWriteBuffer(conn)
+			return conn, nil
+		}
+		Logger.Warn("error dialing statsd", "endpoint", endpoint, "protocol", protocol, "attempt", attempt+1, "error", err)
+		if attempt >= DialRetries {
+			return nil, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// defaultPort is the statsd port used for endpoints without one.
+const defaultPort = "8125"
+
+// normalizeEndpoint appends the default statsd port to an endpoint holding
+// only a host, which may be a bare or bracketed IPv6 address.
+func normalizeEndpoint(endpoint string) (string, error) {
+	if endpoint == "" {
+		return "", errors.New("empty statsd endpoint")
+	}
+	if host, port, err := net.SplitHostPort(endpoint); err == nil {
+		if port == "" {
+			return net.JoinHostPort(host, defaultPort), nil
+		}
+		return endpoint, nil
+	}
+
+	host := endpoint
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if strings.ContainsAny(host, "[]") {
+		return "", fmt.Errorf("invalid statsd endpoint %q", endpoint)
+	}
+	return net.JoinHostPort(host, defaultPort), nil
+}
+
+func setWriteBuffer(conn net.Conn) {
+	if WriteBufferBytes <= 0 {
+		return
+	}
+	b, ok := conn.(interface{ SetWriteBuffer(bytes int) error })
+	if !ok {
+		return
+	}
+	if err := b.SetWriteBuffer(WriteBufferBytes); err != nil {
+		Logger.Warn("error setting write buffer", "bytes", WriteBufferBytes, "error", err)
+		return
+	}
+	// The kernel silently caps the size, the effective one is what to look
+	// at when tuning drops.
+	if size, ok := writeBufferSize(conn); ok {
+		if size < WriteBufferBytes {
+			Logger.Warn("write buffer capped by the system", "bytes", WriteBufferBytes, "effective_bytes", size)
+		} else {
+			Logger.Info("write buffer set", "bytes", WriteBufferBytes, "effective_bytes", size)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package gostats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{"127.0.0.1:9125", "127.0.0.1:9125", false},
+		{"127.0.0.1", "127.0.0.1:8125", false},
+		{"127.0.0.1:", "127.0.0.1:8125", false},
+		{"statsd.local:9125", "statsd.local:9125", false},
+		{"statsd.local", "statsd.local:8125", false},
+		{"[::1]:9125", "[::1]:9125", false},
+		{"[::1]", "[::1]:8125", false},
+		{"::1", "[::1]:8125", false},
+		{"fe80::1", "[fe80::1]:8125", false},
+		{"", "", true},
+		{"[::1", "", true},
+		{"::1]", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEndpoint(tt.endpoint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeEndpoint(%q) error = %v, want error %v", tt.endpoint, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeEndpoint(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestStatsdTCPRedials(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	s, err := dialStatsd(ln.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	first := <-conns
+	if err := s.Gauge("test.first", 1); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(first).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "test.first:1|g\n" {
+		t.Errorf("received %q, want %q", line, "test.first:1|g\n")
+	}
+
+	// Sends into the closed connection fail after the peer resets it, the
+	// sink then redials and resends.
+	first.Close()
+	var second net.Conn
+	for i := 0; second == nil; i++ {
+		if i == 100 {
+			t.Fatal("sink didn't redial")
+		}
+		s.Gauge("test.second", 2)
+		select {
+		case second = <-conns:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer second.Close()
+	line, err = bufio.NewReader(second).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "test.second:2|g\n" {
+		t.Errorf("received %q after redialing, want %q", line, "test.second:2|g\n")
+	}
+	if got := s.Reconnects(); got != 1 {
+		t.Errorf("Reconnects() = %d, want 1", got)
+	}
+}
+
+func TestSetWriteBufferLogsEffectiveSize(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("send buffer size not read back on", runtime.GOOS)
+	}
+	defer func(logger *slog.Logger, size int) { Logger, WriteBufferBytes = logger, size }(Logger, WriteBufferBytes)
+	var buf bytes.Buffer
+	Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	WriteBufferBytes = 64 << 10
+
+	conn, err := net.Dial("udp", "127.0.0.1:8125")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	setWriteBuffer(conn)
+
+	if !strings.Contains(buf.String(), "effective_bytes=") {
+		t.Errorf("effective write buffer size not logged:\n%s", buf.String())
+	}
+}
+
+func TestConfigTransport(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	// The package Transport stays udp, the other collector using it.
+	udp, err := NewWithConfig(Config{Endpoint: "127.0.0.1:8125", Pause: time.Hour, CPU: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Stop()
+	tcp, err := NewWithConfig(Config{Endpoint: ln.Addr().String(), Transport: "tcp", Pause: time.Hour, CPU: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp.Start()
+	defer tcp.Stop()
+
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector didn't connect over TCP")
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(line, "|g\n") {
+		t.Errorf("received %q, want a newline terminated gauge", line)
+	}
+	if s := udp.col.sink.(*statsdSink); s.stream || s.transport != "udp" {
+		t.Errorf("collector without a Transport uses %q, want udp", s.transport)
+	}
+
+	_, err = NewWithConfig(Config{Endpoint: "127.0.0.1:8125", Transport: "sctp", Pause: time.Hour})
+	var oe *OptionError
+	if !errors.As(err, &oe) || oe.Option != "Config.Transport" {
+		t.Errorf("NewWithConfig with an unknown transport = %v, want a Config.Transport OptionError", err)
+	}
+}
@@ -0,0 +1,48 @@
+package gostats
+
+import "math/bits"
+
+// Smooth sets the metrics smoothed over a sliding window, keyed by bucket as
+// listed by Describe, cpu.NumGoroutine say, with the number of samples of
+// the window. Every pass outputs the moving average of the last samples of
+// the metric as key.smoothed along with its raw value, for backends that
+// don't smooth inherently spiky gauges themselves. The average covers fewer
+// samples until the window first fills.
+var Smooth map[string]int
+
+// smoothWindow holds the last samples of a smoothed metric.
+type smoothWindow struct {
+	name    string
+	samples []uint64
+	next    int
+	full    bool
+}
+
+// sendSmoothed adds value to the window of bucket and outputs its average.
+func (c *collector) sendSmoothed(bucket string, value uint64, size int) {
+	w, ok := c.windows[bucket]
+	if !ok {
+		if c.windows == nil {
+			c.windows = make(map[string]*smoothWindow)
+		}
+		w = &smoothWindow{name: bucket + ".smoothed", samples: make([]uint64, 0, size)}
+		c.windows[bucket] = w
+	}
+	if w.full {
+		w.samples[w.next] = value
+	} else {
+		w.samples = append(w.samples, value)
+		w.full = len(w.samples) == cap(w.samples)
+	}
+	w.next = (w.next + 1) % cap(w.samples)
+
+	// The sum is kept on 128 bits, so averaging the largest gauges can't
+	// overflow.
+	var hi, lo, carry uint64
+	for _, v := range w.samples {
+		lo, carry = bits.Add64(lo, v, 0)
+		hi += carry
+	}
+	avg, _ := bits.Div64(hi, lo, uint64(len(w.samples)))
+	c.send(w.name, avg)
+}
@@ -0,0 +1,114 @@
+package gostats
+
+import (
+	"sync"
+)
+
+// GaugeFunc outputs the value of a metric under bucket, which is composed
+// into the full key like the built-in ones.
+type GaugeFunc func(bucket string, value uint64)
+
+// Source is a set of metrics output every interval by calling gauge for each
+// of them, for extending the collector beyond the runtime statistics. A
+// Source can wrap another, adding metrics and delegating to it, including the
+// built-in runtime statistics returned by NewRuntimeSource.
+type Source interface {
+	Collect(gauge GaugeFunc)
+}
+
+// Sources registered with RegisterSource, output by every collector.
+var (
+	sourcesMu sync.Mutex
+	sources   []Source
+)
+
+// RegisterSource makes the collector output the metrics of s every
+// interval. Collect is called by every collector and Handler, on their
+// collection goroutine or the one serving the scrape, but never by two of
+// them at once.
+func RegisterSource(s Source) {
+	sourcesMu.Lock()
+	sources = append(sources, s)
+	sourcesMu.Unlock()
+}
+
+// callbacksMu serializes the calls into the registered structs, gauges and
+// sources, made by every collector and Handler, so none of them has to be
+// safe for concurrent use.
+var callbacksMu sync.Mutex
+
+// outputUserMetrics outputs the metrics registered by the program.
+func (c *collector) outputUserMetrics() {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	c.outputRegistered()
+	c.outputConstants()
+	c.outputGauges()
+	c.outputSources()
+}
+
+func (c *collector) outputSources() {
+	sourcesMu.Lock()
+	list := sources
+	sourcesMu.Unlock()
+
+	for _, s := range list {
+		s.Collect(c.gaugeFunc)
+	}
+}
+
+// runtimeSource outputs the runtime statistics through a collector of its
+// own, keeping the state deltas are computed from between calls.
+type runtimeSource struct {
+	col  *collector
+	sink funcSink
+}
+
+// NewRuntimeSource returns a Source outputting the runtime statistics the
+// collector does, configured from the package options, with every statistic
+// enabled. It is meant to be wrapped by a Source of your own and registered
+// with a collector that has its built-in statistics disabled, so they aren't
+// output twice. Calls to Collect must not overlap.
+func NewRuntimeSource() Source {
+	// Keys and values are shaped by the collector the source is registered
+	// with, leave them untouched here.
+	opts := packageSettings()
+	opts.keyTemplate = ""
+	opts.includeBinaryName = false
+	opts.keyScheme = SchemeNative
+	opts.goldenSignalsOnly = false
+	opts.compactKeys = false
+	opts.sanitize = nil
+	opts.transform = nil
+	opts.maxKeyLen = 0
+	opts.maxValue = 0
+	opts.maxSeries = 0
+	opts.thresholdsAbove = nil
+	opts.thresholdsBelow = nil
+	opts.suppressUnchanged = false
+	opts.historySize = 0
+
+	rs := &runtimeSource{}
+	rs.col = newCollector("", &rs.sink, opts)
+	rs.col.setEnabled(true, true, true)
+	return rs
+}
+
+func (rs *runtimeSource) Collect(gauge GaugeFunc) {
+	rs.sink.gauge = gauge
+	rs.col.collect(allSections&^sectionOther, nil)
+}
+
+// funcSink hands every metric to a GaugeFunc.
+type funcSink struct {
+	gauge GaugeFunc
+}
+
+func (s *funcSink) Gauge(key string, value uint64) error {
+	s.gauge(key, value)
+	return nil
+}
+
+func (s *funcSink) Flush() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package gostats
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// overlapSource records how many of its Collect calls ran at once.
+type overlapSource struct {
+	active atomic.Int32
+	max    atomic.Int32
+}
+
+func (s *overlapSource) Collect(gauge GaugeFunc) {
+	n := s.active.Add(1)
+	for m := s.max.Load(); n > m && !s.max.CompareAndSwap(m, n); m = s.max.Load() {
+	}
+	time.Sleep(100 * time.Microsecond)
+	s.active.Add(-1)
+}
+
+// registerOverlapSource registers an overlapSource for the duration of the
+// test.
+func registerOverlapSource(t *testing.T) *overlapSource {
+	t.Helper()
+	sourcesMu.Lock()
+	saved := sources
+	sourcesMu.Unlock()
+	t.Cleanup(func() {
+		sourcesMu.Lock()
+		sources = saved
+		sourcesMu.Unlock()
+	})
+
+	s := &overlapSource{}
+	RegisterSource(s)
+	return s
+}
+
+func TestSupportedMetricsDoesntOverlapCollection(t *testing.T) {
+	defer func(col *collector) { c = col }(c)
+	s := registerOverlapSource(t)
+
+	col, err := NewWithConfig(Config{Sink: discardSink{}, Pause: time.Millisecond, CPU: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = col.col
+	col.Start()
+	for i := 0; i < 50; i++ {
+		SupportedMetrics()
+	}
+	col.Stop()
+
+	if max := s.max.Load(); max > 1 {
+		t.Errorf("%d Source.Collect calls overlapped, want none", max)
+	}
+}
+
+// panicSource panics in Collect once armed, then disarms.
+type panicSource struct {
+	armed atomic.Bool
+}
+
+func (s *panicSource) Collect(gauge GaugeFunc) {
+	if s.armed.CompareAndSwap(true, false) {
+		panic("source failed")
+	}
+}
+
+func TestOutputFromReturnsAfterPanic(t *testing.T) {
+	defer func(col *collector, backoff time.Duration, recover bool, onStart bool) {
+		c, RestartBackoff, RecoverPanics, EmitOnStart = col, backoff, recover, onStart
+	}(c, RestartBackoff, RecoverPanics, EmitOnStart)
+	RestartBackoff, RecoverPanics, EmitOnStart = time.Millisecond, false, false
+
+	sourcesMu.Lock()
+	saved := sources
+	sourcesMu.Unlock()
+	defer func() {
+		sourcesMu.Lock()
+		sources = saved
+		sourcesMu.Unlock()
+	}()
+	s := &panicSource{}
+	RegisterSource(s)
+
+	col, err := NewWithConfig(Config{Sink: discardSink{}, Pause: time.Hour, CPU: true, Mem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = col.col
+	col.Start()
+	defer col.Stop()
+
+	s.armed.Store(true)
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	returned := make(chan error, 1)
+	go func() { returned <- OutputFrom(&m) }()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OutputFrom didn't return after the pass panicked")
+	}
+
+	// The collector restarted and serves OutputFrom again.
+	go func() { returned <- OutputFrom(&m) }()
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Errorf("OutputFrom after the restart = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OutputFrom didn't return after the restart")
+	}
+}
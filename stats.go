@@ -0,0 +1,118 @@
+package gostats
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CollectorStats holds the self-diagnostics of a collector, as opposed to the
+// runtime statistics it collects.
+type CollectorStats struct {
+	// Passes is the number of collection passes made.
+	Passes uint64
+
+	// Emitted is the number of metrics handed to the sink successfully.
+	Emitted uint64
+
+	// SendErrors is the number of metrics the sink failed to take, LastError
+	// the latest such failure or flush failure.
+	SendErrors uint64
+	LastError  error
+
+	// LastPassDuration is how long the latest collection pass took.
+	LastPassDuration time.Duration
+
+	// Interval is the collection interval.
+	Interval time.Duration
+
+	// Reconnects is the number of times the statsd connection failed over
+	// to another endpoint.
+	Reconnects uint64
+
+	// BreakerOpen is whether collection is paused by the circuit breaker,
+	// BreakerTrips how many times it opened.
+	BreakerOpen  bool
+	BreakerTrips uint64
+
+	// Restarts is the number of times collection restarted after stopping
+	// on its own, with RestartBackoff.
+	Restarts uint64
+}
+
+// diagnostics are the counters behind CollectorStats, updated by the
+// collection goroutine and read from any other.
+type diagnostics struct {
+	passes       atomic.Uint64
+	emitted      atomic.Uint64
+	sendErrors   atomic.Uint64
+	lastPassTime atomic.Int64
+	breakerOpen  atomic.Bool
+	breakerTrips atomic.Uint64
+	restarts     atomic.Uint64
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// reconnectingSink is a Sink that reconnects and reports how many times.
+type reconnectingSink interface {
+	Reconnects() uint64
+}
+
+// Stats returns the self-diagnostics of the running collector, the zero
+// value if Collect hasn't been called.
+func Stats() CollectorStats {
+	if c == nil {
+		return CollectorStats{}
+	}
+	return c.stats()
+}
+
+func (c *collector) stats() CollectorStats {
+	d := &c.diag
+	s := CollectorStats{
+		Passes:           d.passes.Load(),
+		Emitted:          d.emitted.Load(),
+		SendErrors:       d.sendErrors.Load(),
+		LastPassDuration: time.Duration(d.lastPassTime.Load()),
+		Interval:         c.pauseDur,
+		BreakerOpen:      d.breakerOpen.Load(),
+		BreakerTrips:     d.breakerTrips.Load(),
+		Restarts:         d.restarts.Load(),
+	}
+	d.mu.Lock()
+	s.LastError = d.lastErr
+	d.mu.Unlock()
+	if r, ok := c.sink.(reconnectingSink); ok {
+		s.Reconnects = r.Reconnects()
+	}
+	return s
+}
+
+// sendFailed logs and records the failure to send key.
+func (c *collector) sendFailed(key string, err error) {
+	c.logger.Error("error sending data", "key", key, "error", err)
+	c.diag.sendErrors.Add(1)
+	c.setLastError(err)
+
+	c.failures++
+	if c.breakerFailures > 0 && c.failures >= c.breakerFailures && !time.Now().Before(c.breakerUntil) {
+		c.breakerUntil = time.Now().Add(c.breakerBackoff)
+		c.diag.breakerOpen.Store(true)
+		c.diag.breakerTrips.Add(1)
+		c.logger.Warn("sink failing, pausing collection", "failures", c.failures, "backoff", c.breakerBackoff)
+
+		c.trips++
+		if c.breakerMaxTrips > 0 && c.trips >= c.breakerMaxTrips {
+			c.fatal = fmt.Errorf("%w after %d breaker trips: %w", ErrSinkFailed, c.trips, err)
+		}
+	}
+}
+
+func (c *collector) setLastError(err error) {
+	c.diag.mu.Lock()
+	c.diag.lastErr = err
+	c.diag.mu.Unlock()
+}
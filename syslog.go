@@ -0,0 +1,66 @@
+//go:build !windows && !plan9
+
+package gostats
+
+import (
+	"bytes"
+	"log/syslog"
+	"strconv"
+)
+
+// SyslogSink writes the metrics to the system logger, for setups built
+// around syslog aggregation. Every collection pass is written as a single
+// summary message of space separated key=value pairs, or as one message per
+// metric if PerMetric is set. It isn't available on Windows.
+type SyslogSink struct {
+	// PerMetric writes one message per metric instead of one per pass.
+	PerMetric bool
+
+	w   *syslog.Writer
+	buf bytes.Buffer
+}
+
+// NewSyslogSink returns a sink writing to the local system logger with the
+// given facility and severity, and tag, for use with CollectTo.
+func NewSyslogSink(priority syslog.Priority, tag string) (*SyslogSink, error) {
+	w, err := syslog.New(priority, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Gauge(key string, value uint64) error {
+	if s.PerMetric {
+		s.buf.Reset()
+		s.appendPair(key, value)
+		_, err := s.w.Write(s.buf.Bytes())
+		return err
+	}
+
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte(' ')
+	}
+	s.appendPair(key, value)
+	return nil
+}
+
+func (s *SyslogSink) appendPair(key string, value uint64) {
+	s.buf.WriteString(key)
+	s.buf.WriteByte('=')
+	s.buf.WriteString(strconv.FormatUint(value, 10))
+}
+
+func (s *SyslogSink) Flush() error {
+	if s.PerMetric || s.buf.Len() == 0 {
+		return nil
+	}
+	defer s.buf.Reset()
+
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
+
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,73 @@
+package gostats
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// KeyTemplate, when set, replaces the prefix composition of keys. It is
+// evaluated for every metric, with the placeholders:
+//
+//	{key}        the metric bucket, such as mem.heap.Alloc
+//	{prefix}     the prefix given to Collect
+//	{host}       the hostname, dots replaced by underscores
+//	{pid}        the process id
+//	{goversion}  the Go version, dots replaced by underscores
+//	{binary}     the binary name, as for IncludeBinaryName
+//
+// along with any name in KeyTemplateValues. For example "{host}.{key}".
+var KeyTemplate = ""
+
+// IncludeBinaryName appends the base name of the running binary to the
+// prefix, myserver.mem.heap.Alloc say, keeping apart the metrics of several
+// binaries sharing a statsd on one host without configuring each. Characters
+// other than letters, digits, dashes and underscores, dots included, are
+// replaced with underscores. It is ignored when KeyTemplate is set, which
+// takes {binary} instead, along with {host} to combine both.
+var IncludeBinaryName = false
+
+// KeyTemplateValues holds custom KeyTemplate placeholders, mapping the
+// placeholder name without braces to its value.
+var KeyTemplateValues map[string]string
+
+// templateParts evaluates the key template around its {key} placeholder,
+// returning the parts before and after every bucket.
+func templateParts(template string, prefix string, custom map[string]string) (head string, tail string) {
+	host, _ := os.Hostname()
+	pairs := []string{
+		"{prefix}", prefix,
+		"{host}", strings.ReplaceAll(host, ".", "_"),
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{goversion}", strings.ReplaceAll(runtime.Version(), ".", "_"),
+		"{binary}", binaryName(),
+	}
+	for name, value := range custom {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	r := strings.NewReplacer(pairs...)
+
+	head, tail, found := strings.Cut(template, "{key}")
+	if !found {
+		// Without a {key} placeholder every metric would share one key.
+		return r.Replace(template) + ".", ""
+	}
+	return r.Replace(head), r.Replace(tail)
+}
+
+// binaryName returns the base name of the running binary, sanitized for use
+// as a key part.
+func binaryName() string {
+	var name string
+	if len(os.Args) > 0 {
+		name = filepath.Base(os.Args[0])
+	} else if exe, err := os.Executable(); err == nil {
+		name = filepath.Base(exe)
+	}
+	return replaceInvalid(name, func(i int, ch byte) bool {
+		return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_'
+	})
+}
@@ -0,0 +1,149 @@
+//go:build !windows && !plan9
+
+package gostats
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// UnixSink writes the metrics as newline terminated statsd lines to a local
+// agent listening on a Unix stream socket, in the format and with the tags
+// of the statsd sink. Lines are buffered and written without blocking at the
+// end of every pass, so a slow agent never holds up the collection: what the
+// socket doesn't take is kept for the next pass, and once the buffer is full
+// the oldest lines are dropped, counted by Dropped and output as
+// cpu.SinkDropped. A line partly written is always completed. It isn't
+// available on Windows.
+type UnixSink struct {
+	*statsdSink
+	ring *unixRing
+}
+
+// unixRing is the connection the statsd sink writes to, buffering lines for
+// the non-blocking writes of flush.
+type unixRing struct {
+	*net.UnixConn
+	raw syscall.RawConn
+
+	// Lines waiting to be written, up to max bytes. The first partial
+	// bytes are what remains of a line partly written and can't be dropped.
+	buf     []byte
+	max     int
+	partial int
+
+	dropped atomic.Uint64
+}
+
+// NewUnixSink connects to the Unix stream socket at path and returns a sink
+// buffering up to bufferBytes of lines for it, for use with CollectTo.
+func NewUnixSink(path string, bufferBytes int) (*UnixSink, error) {
+	if bufferBytes <= 0 {
+		return nil, errors.New("unix sink buffer must be positive")
+	}
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newUnixSink(conn.(*net.UnixConn), bufferBytes)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	Logger.Info("connected to statsd", "endpoint", path, "protocol", "unix")
+	return s, nil
+}
+
+// newUnixSink returns a sink buffering up to bufferBytes of lines for uc.
+func newUnixSink(uc *net.UnixConn, bufferBytes int) (*UnixSink, error) {
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	r := &unixRing{UnixConn: uc, raw: raw, max: bufferBytes}
+	s := newStatsdSink(r, "unix")
+	return &UnixSink{statsdSink: s, ring: r}, nil
+}
+
+// Flush writes what the socket takes of the buffered lines.
+func (s *UnixSink) Flush() error {
+	return s.ring.flush()
+}
+
+// Dropped returns the number of lines dropped because the buffer was full.
+func (s *UnixSink) Dropped() uint64 {
+	return s.ring.dropped.Load()
+}
+
+// Buffered returns the number of bytes waiting to be written.
+func (s *UnixSink) Buffered() int {
+	return len(s.ring.buf)
+}
+
+// Reconnects shadows the failover count of the statsd sink, which doesn't
+// apply to a single socket.
+func (s *UnixSink) Reconnects() uint64 {
+	return 0
+}
+
+// Write buffers line, dropping the oldest whole lines to make room. A line
+// too long for the buffer is dropped itself.
+func (r *unixRing) Write(line []byte) (int, error) {
+	if r.partial+len(line) > r.max {
+		r.dropped.Add(1)
+		return len(line), nil
+	}
+	drop := r.partial
+	for len(r.buf)-(drop-r.partial)+len(line) > r.max {
+		drop += bytes.IndexByte(r.buf[drop:], '\n') + 1
+		r.dropped.Add(1)
+	}
+	if drop > r.partial {
+		r.buf = append(r.buf[:r.partial], r.buf[drop:]...)
+	}
+	r.buf = append(r.buf, line...)
+	return len(line), nil
+}
+
+// SetWriteDeadline is a no-op, writes never block.
+func (r *unixRing) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// flush writes the buffered lines once, taking a short write or EAGAIN as
+// the socket being full and keeping the rest.
+func (r *unixRing) flush() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	var n int
+	var werr error
+	if err := r.raw.Write(func(fd uintptr) bool {
+		n, werr = syscall.Write(int(fd), r.buf)
+		return true
+	}); err != nil {
+		return err
+	}
+	if werr == syscall.EAGAIN || werr == syscall.EINTR {
+		n, werr = 0, nil
+	}
+	if werr != nil {
+		return werr
+	}
+
+	// The write may have stopped midway through a line.
+	switch {
+	case n < r.partial:
+		r.partial -= n
+	case n > 0 && n < len(r.buf) && r.buf[n-1] != '\n':
+		r.partial = bytes.IndexByte(r.buf[n:], '\n') + 1
+	default:
+		r.partial = 0
+	}
+	r.buf = append(r.buf[:0], r.buf[n:]...)
+	return nil
+}
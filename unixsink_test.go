@@ -0,0 +1,124 @@
+//go:build !windows && !plan9
+
+package gostats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+)
+
+// newSlowUnixSink returns a sink writing to one end of a socket pair with a
+// small send buffer, and the other end, which nothing reads until the test
+// does.
+func newSlowUnixSink(t *testing.T, bufferBytes int) (*UnixSink, net.Conn) {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.SetsockoptInt(fds[0], syscall.SOL_SOCKET, syscall.SO_SNDBUF, 4096); err != nil {
+		t.Fatal(err)
+	}
+	conn := func(fd int) net.Conn {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		defer f.Close()
+		c, err := net.FileConn(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	w, r := conn(fds[0]), conn(fds[1])
+	t.Cleanup(func() { w.Close(); r.Close() })
+
+	s, err := newUnixSink(w.(*net.UnixConn), bufferBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, r
+}
+
+func TestUnixSinkDropsOldest(t *testing.T) {
+	s, _ := newSlowUnixSink(t, 64)
+	for i := 0; i < 10; i++ {
+		s.Gauge(fmt.Sprintf("key.%d", i), 1234567890)
+	}
+	// Every line is 19 bytes, three fit in the buffer.
+	if got, want := string(s.ring.buf), "key.7:1234567890|g\nkey.8:1234567890|g\nkey.9:1234567890|g\n"; got != want {
+		t.Errorf("buffered %q, want %q", got, want)
+	}
+	if got := s.Dropped(); got != 7 {
+		t.Errorf("Dropped() = %d, want 7", got)
+	}
+}
+
+func TestUnixSinkCompletesPartialLines(t *testing.T) {
+	s, r := newSlowUnixSink(t, 1<<15)
+
+	// Flush more than the socket takes at once, the reader never reading,
+	// so a line is cut short, then keep writing to make the buffer drop
+	// old lines. The line cut short must still be completed.
+	const passes = 2000
+	write := func(i int) {
+		for j := 0; j < 10; j++ {
+			s.Gauge(fmt.Sprintf("pass.%d.key.%d", i, j), uint64(i*j))
+		}
+	}
+	for i := 0; i < 100; i++ {
+		write(i)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.ring.partial == 0 {
+		t.Fatal("no line cut short by the socket")
+	}
+	for i := 100; i < passes; i++ {
+		write(i)
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Dropped() == 0 {
+		t.Fatal("no line dropped with the socket full")
+	}
+
+	// Drain the socket, flushing what is left.
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s.Buffered() > 0 {
+			if err := s.Flush(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		s.ring.UnixConn.CloseWrite()
+	}()
+
+	valid := regexp.MustCompile(`^pass\.\d+\.key\.\d+:\d+\|g$`)
+	received := 0
+	for line := range lines {
+		if !valid.MatchString(line) {
+			t.Errorf("received malformed line %q", line)
+		}
+		received++
+	}
+	<-done
+	if want := passes*10 - int(s.Dropped()); received != want {
+		t.Errorf("received %d lines, want %d", received, want)
+	}
+}
@@ -0,0 +1,187 @@
+package gostats
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OptionError reports an invalid package option.
+type OptionError struct {
+	// Option is the name of the invalid option, such as MaxKeyLen.
+	Option string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return "invalid " + e.Option + ": " + e.Reason
+}
+
+// Validate checks the package options, returning every problem found joined
+// into one error so they can all be fixed at once. Each is an *OptionError
+// naming the option, retrievable with errors.As. Collect, CollectTo and Run
+// call it before starting.
+func Validate() error {
+	return errors.Join(optionErrors()...)
+}
+
+// validateStart checks the package options along with the arguments of a
+// collector being started, and the statsd endpoints it will dial.
+func validateStart(pause time.Duration, endpoints ...string) error {
+	errs := optionErrors()
+	if pause <= 0 {
+		errs = append(errs, &OptionError{"pauseDuration", fmt.Sprintf("must be positive, got %v", pause)})
+	}
+	for _, endpoint := range endpoints {
+		if _, err := normalizeEndpoint(endpoint); err != nil {
+			errs = append(errs, &OptionError{"endpoint", err.Error()})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkTransport reports a transport other than udp and tcp as an invalid
+// option.
+func checkTransport(option string, transport string) error {
+	if transport != "udp" && transport != "tcp" {
+		return &OptionError{option, fmt.Sprintf("unknown transport %q, want udp or tcp", transport)}
+	}
+	return nil
+}
+
+func optionErrors() []error {
+	var errs []error
+	invalid := func(option string, format string, args ...interface{}) {
+		errs = append(errs, &OptionError{option, fmt.Sprintf(format, args...)})
+	}
+
+	if MaxKeyLen < 0 {
+		invalid("MaxKeyLen", "negative value %d", MaxKeyLen)
+	}
+	if LongKeyPolicy < LongKeyWarn || LongKeyPolicy > LongKeyHash {
+		invalid("LongKeyPolicy", "unknown policy %d", LongKeyPolicy)
+	} else if LongKeyPolicy != LongKeyWarn && MaxKeyLen == 0 {
+		// Harmless, keys are just left as they are.
+		Logger.Warn("LongKeyPolicy has no effect without MaxKeyLen")
+	}
+	if err := checkTransport("Transport", Transport); err != nil {
+		errs = append(errs, err)
+	}
+	if DialRetries < 0 {
+		invalid("DialRetries", "negative value %d", DialRetries)
+	}
+	if DialBackoff < 0 {
+		invalid("DialBackoff", "negative duration %v", DialBackoff)
+	}
+	if ShutdownTimeout < 0 {
+		invalid("ShutdownTimeout", "negative duration %v", ShutdownTimeout)
+	}
+	if CPUInterval < 0 {
+		invalid("CPUInterval", "negative duration %v", CPUInterval)
+	}
+	if MemInterval < 0 {
+		invalid("MemInterval", "negative duration %v", MemInterval)
+	}
+	if GoroutineSamples < 0 {
+		invalid("GoroutineSamples", "negative value %d", GoroutineSamples)
+	}
+	if DeltaMode < AbsoluteOnly || DeltaMode > AbsoluteAndDelta {
+		invalid("DeltaMode", "unknown mode %d", DeltaMode)
+	}
+	if OnShutdown < ShutdownZero || OnShutdown > ShutdownNone {
+		invalid("OnShutdown", "unknown mode %d", OnShutdown)
+	}
+	if HistorySize < 0 {
+		invalid("HistorySize", "negative value %d", HistorySize)
+	}
+	if WarmupIntervals < 0 {
+		invalid("WarmupIntervals", "negative value %d", WarmupIntervals)
+	}
+	if BreakerFailures < 0 {
+		invalid("BreakerFailures", "negative value %d", BreakerFailures)
+	}
+	if BreakerMaxTrips < 0 {
+		invalid("BreakerMaxTrips", "negative value %d", BreakerMaxTrips)
+	} else if BreakerMaxTrips > 0 && BreakerFailures == 0 {
+		invalid("BreakerMaxTrips", "has no effect without BreakerFailures")
+	}
+	if RestartBackoff < 0 {
+		invalid("RestartBackoff", "negative duration %v", RestartBackoff)
+	}
+	if BreakerFailures > 0 && BreakerBackoff <= 0 {
+		invalid("BreakerBackoff", "must be positive when BreakerFailures is set")
+	}
+	if MaxSeries < 0 {
+		invalid("MaxSeries", "negative value %d", MaxSeries)
+	}
+	if BySizeTopN < 0 {
+		invalid("BySizeTopN", "negative value %d", BySizeTopN)
+	}
+	if LargeValues < OverflowDecimal || LargeValues > OverflowClamp {
+		invalid("LargeValues", "unknown policy %d", LargeValues)
+	}
+	if KeyScheme < SchemeNative || KeyScheme > SchemeGoRuntimeMetrics {
+		invalid("KeyScheme", "unknown scheme %d", KeyScheme)
+	}
+	if TagStyle < TagsDogStatsD || TagStyle > TagsGraphite {
+		invalid("TagStyle", "unknown style %d", TagStyle)
+	}
+	tags := make([]string, 0, len(Tags))
+	for name := range Tags {
+		tags = append(tags, name)
+	}
+	sort.Strings(tags)
+	for _, name := range tags {
+		if name == "" || strings.ContainsAny(name, tagSeparators+":=") {
+			invalid("Tags", "invalid tag name %q", name)
+		} else if strings.ContainsAny(Tags[name], tagSeparators) {
+			invalid("Tags", "invalid value %q of tag %s", Tags[name], name)
+		}
+	}
+	if WriteBufferBytes < 0 {
+		invalid("WriteBufferBytes", "negative value %d", WriteBufferBytes)
+	}
+
+	w := GCPressure
+	if w.Frequency < 0 || w.PauseFraction < 0 || w.Headroom < 0 {
+		invalid("GCPressure", "negative weight")
+	}
+	if w.Frequency > 0 && w.MaxGCPerSecond <= 0 {
+		invalid("GCPressure", "MaxGCPerSecond must be positive when Frequency is weighted")
+	}
+	if w.PauseFraction > 0 && w.MaxPauseFraction <= 0 {
+		invalid("GCPressure", "MaxPauseFraction must be positive when PauseFraction is weighted")
+	}
+	if t := MemPressure; t.GCPerSecond < 0 || t.PauseFraction < 0 || t.LimitHeadroom < 0 {
+		invalid("MemPressure", "negative threshold")
+	}
+
+	// Report windows and sample rates in key order so the error is stable.
+	buckets := make([]string, 0, len(Smooth))
+	for bucket := range Smooth {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		if size := Smooth[bucket]; size < 1 {
+			invalid("Smooth", "window of %s must be positive, got %d", bucket, size)
+		}
+	}
+
+	if SampleRate <= 0 || SampleRate > 1 {
+		invalid("SampleRate", "rate %v outside (0, 1]", SampleRate)
+	}
+	keys := make([]string, 0, len(SampleRates))
+	for key := range SampleRates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if rate := SampleRates[key]; rate <= 0 || rate > 1 {
+			invalid("SampleRates", "rate %v of %s outside (0, 1]", rate, key)
+		}
+	}
+	return errs
+}
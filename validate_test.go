@@ -0,0 +1,24 @@
+package gostats
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLongKeyPolicyWithoutMaxKeyLenWarns(t *testing.T) {
+	defer func(logger *slog.Logger, policy KeyPolicy, maxLen int) {
+		Logger, LongKeyPolicy, MaxKeyLen = logger, policy, maxLen
+	}(Logger, LongKeyPolicy, MaxKeyLen)
+	var buf bytes.Buffer
+	Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	LongKeyPolicy, MaxKeyLen = LongKeyHash, 0
+
+	if err := Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+	if !strings.Contains(buf.String(), "LongKeyPolicy has no effect without MaxKeyLen") {
+		t.Errorf("no warning about LongKeyPolicy logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,100 @@
+package gostats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts every collection pass to a URL as a JSON object in the
+// format of JSONSink, for ingestion APIs without a dedicated sink. Posts are
+// made from a goroutine of their own so a slow endpoint never holds up the
+// collection; passes that find the queue full are dropped and counted by
+// Dropped, and failed posts are logged.
+type WebhookSink struct {
+	url     string
+	headers http.Header
+	client  *http.Client
+
+	body  bytes.Buffer
+	json  *JSONSink
+	queue *asyncQueue[[]byte]
+}
+
+// NewWebhookSink returns a sink posting to url with the given extra headers,
+// such as an authorization token, giving up on a post after timeout.
+func NewWebhookSink(url string, headers http.Header, timeout time.Duration) *WebhookSink {
+	s := &WebhookSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+	s.json = NewJSONSink(&s.body)
+	s.queue = newAsyncQueue(s.post)
+	return s
+}
+
+func (s *WebhookSink) Gauge(key string, value uint64) error {
+	return s.json.Gauge(key, value)
+}
+
+func (s *WebhookSink) GaugeAt(key string, value uint64, ts time.Time) error {
+	return s.json.GaugeAt(key, value, ts)
+}
+
+func (s *WebhookSink) Flush() error {
+	if err := s.json.Flush(); err != nil {
+		return err
+	}
+	if s.body.Len() == 0 {
+		return nil
+	}
+	s.queue.push(bytes.Clone(s.body.Bytes()))
+	s.body.Reset()
+	return nil
+}
+
+// Drain waits for the queued passes to be posted until ctx is done.
+func (s *WebhookSink) Drain(ctx context.Context) (flushed int, dropped int, err error) {
+	return s.queue.drain(ctx)
+}
+
+// Close posts the passes still queued and stops the posting goroutine.
+func (s *WebhookSink) Close() error {
+	s.queue.close()
+	return nil
+}
+
+// Dropped returns the number of passes dropped because the queue was full.
+func (s *WebhookSink) Dropped() uint64 {
+	return s.queue.dropped.Load()
+}
+
+func (s *WebhookSink) post(body []byte) {
+	if err := s.send(body); err != nil {
+		Logger.Error("error posting to webhook", "url", s.url, "error", err)
+	}
+}
+
+func (s *WebhookSink) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package gostats
+
+import "net"
+
+// writeBufferSize reports nothing, the send buffer size being read back on
+// Unix systems only.
+func writeBufferSize(conn net.Conn) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,30 @@
+//go:build !windows && !plan9
+
+package gostats
+
+import (
+	"net"
+	"syscall"
+)
+
+// writeBufferSize returns the socket send buffer size of conn as the kernel
+// reports it, which may differ from the one set: Linux doubles it for its
+// bookkeeping and caps it to net.core.wmem_max.
+func writeBufferSize(conn net.Conn) (int, bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var size int
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		size, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	}); err != nil || serr != nil {
+		return 0, false
+	}
+	return size, true
+}